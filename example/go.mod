@@ -4,12 +4,12 @@ go 1.21.0
 
 require (
 	github.com/dio/magex v0.0.1
+	github.com/dustin/go-humanize v1.0.1
 	github.com/magefile/mage v1.15.0
 )
 
 require (
 	github.com/codeclysm/extract/v3 v3.1.1 // indirect
-	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/h2non/filetype v1.1.3 // indirect
 	github.com/juju/errors v0.0.0-20181118221551-089d3ea4e4d5 // indirect
 	github.com/klauspost/compress v1.15.13 // indirect
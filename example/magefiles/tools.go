@@ -4,11 +4,16 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"strings"
+	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/magefile/mage/mg"
 
 	"github.com/dio/magex/tool"
+	"github.com/dio/magex/tool/installable"
 )
 
 var box *tool.Box
@@ -28,8 +33,122 @@ func (Tools) All(ctx context.Context) error {
 	return toolbox().InstallAll(ctx)
 }
 
+// Frozen downloads all defined tools in .magetools.yaml, failing when .magetools.lock disagrees.
+func (Tools) Frozen(ctx context.Context) error {
+	toolbox().SetFrozen(true)
+	return toolbox().InstallAll(ctx)
+}
+
+// Group downloads the tools of group in .magetools.yaml, e.g. proto, with their runtimes.
+func (Tools) Group(ctx context.Context, group string) error {
+	return toolbox().InstallGroup(ctx, group)
+}
+
+// Plan reports what tools:all would install or skip, without installing anything.
+func (Tools) Plan() error {
+	return printPlan(toolbox().Plan())
+}
+
+// PlanGroup reports what tools:group would install or skip for group, without installing
+// anything.
+func (Tools) PlanGroup(group string) error {
+	return printPlan(toolbox().PlanGroup(group))
+}
+
+func printPlan(planned []tool.PlannedTool, err error) error {
+	if err != nil {
+		return err
+	}
+	for _, planned := range planned {
+		if planned.Skipped != "" {
+			fmt.Printf("Would skip %s, when %s\n", planned.Name, planned.Skipped)
+			continue
+		}
+		fmt.Printf("Would install %s\n", planned.Name)
+	}
+	return nil
+}
+
+// Validate checks .magetools.yaml without installing anything, e.g. in a pre-commit hook.
+func (Tools) Validate() error {
+	file, err := tool.FindConfig(".")
+	if err != nil {
+		return err
+	}
+	return tool.ValidateFile(file)
+}
+
+// Schema writes the JSON Schema of .magetools.yaml to out, e.g. for yaml-language-server.
+func (Tools) Schema(out string) error {
+	data, err := installable.JSONSchema()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, data, 0o644)
+}
+
+// Config prints the effective .magetools.yaml, i.e. merged with the files it includes.
+func (Tools) Config() {
+	fmt.Print(string(toolbox().Config()))
+}
+
 // Run enables to run a locally installed tool.
 // Caveat: need to "wrap" the args with ” or "". For example: mage tools:run buf '--version'.
 func (Tools) Run(ctx context.Context, name, rest string) error {
 	return toolbox().Run(ctx, name, strings.Split(rest, " ")...)
 }
+
+// Checksums downloads the artifacts of names, e.g. helm,kind, or of all tools when empty, and rewrites
+// their shas in .magetools.yaml.
+func (Tools) Checksums(ctx context.Context, names string) error {
+	if names == "" {
+		return toolbox().UpdateChecksums(ctx)
+	}
+	return toolbox().UpdateChecksums(ctx, strings.Split(names, ",")...)
+}
+
+// Vendor bundles the artifacts of all tools for platforms, e.g. linux-amd64,darwin-arm64, into out.
+func (Tools) Vendor(ctx context.Context, out, platforms string) error {
+	if platforms == "" {
+		return toolbox().Vendor(ctx, out)
+	}
+	return toolbox().Vendor(ctx, out, strings.Split(platforms, ",")...)
+}
+
+// Restore installs all tools from a bundle written by tools:vendor, without network.
+func (Tools) Restore(ctx context.Context, in string) error {
+	return toolbox().Restore(ctx, in)
+}
+
+// Prune removes the installed versions not declared anymore, except the ones used within keep, e.g.
+// 168h. With dryRun, it only reports what it would remove.
+func (Tools) Prune(ctx context.Context, keep time.Duration, dryRun bool) error {
+	result, err := toolbox().Prune(ctx, tool.PruneOptions{DryRun: dryRun, KeepUsedWithin: keep})
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	for _, versioned := range result.Removed {
+		fmt.Printf("%s %s\n", verb, versioned)
+	}
+	fmt.Printf("Reclaimed %s\n", humanize.Bytes(result.Reclaimed))
+	return err
+}
+
+// Evict trims the download cache shared across projects to maxSize, e.g. 1GB. Use 0 to empty it.
+func (Tools) Evict(maxSize string) error {
+	cache := toolbox().Cache()
+	if cache == nil {
+		return nil
+	}
+	size, err := humanize.ParseBytes(maxSize)
+	if err != nil {
+		return err
+	}
+	reclaimed, err := cache.Evict(size)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reclaimed %s from %s\n", humanize.Bytes(reclaimed), cache.Dir())
+	return nil
+}
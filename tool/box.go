@@ -2,11 +2,16 @@ package tool
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
-	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/magefile/mage/sh"
 
 	"github.com/dio/magex/tool/installable"
@@ -26,62 +31,305 @@ func LoadDefault() (*Box, error) {
 	return Load("magetools")
 }
 
-// LoadFromFile loads installable from file.
+// LoadFromFile loads installable from file, merged with the files it includes, and puts the
+// installation destination to dir, or the one set by DirEnv. A relative dir is relative to the
+// root of the git repository of file, or to the directory of file outside of one. The lock is read
+// from and written to the file with its extension replaced by .lock, e.g. .magetools.lock for
+// .magetools.yaml.
 func LoadFromFile(dir, file string) (*Box, error) {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
 	data, err := os.ReadFile(file)
 	if err != nil {
 		return nil, err
 	}
-	return LoadFromData(dir, data)
+	data, err = merge(file, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	box, err := loadFromData(installDir(dir, filepath.Dir(file)), data)
+	if err != nil {
+		return nil, err
+	}
+	if err = box.useLockFile(strings.TrimSuffix(file, filepath.Ext(file)) + ".lock"); err != nil {
+		return nil, err
+	}
+	box.configFile = file
+	return box, nil
 }
 
-// LoadFromData loads installable from data.
+// LoadFromData loads installable from data, and puts the installation destination to dir, or the
+// one set by DirEnv. A relative dir is relative to the root of the git repository of the working
+// directory, or to the working directory outside of one.
 func LoadFromData(dir string, data []byte) (*Box, error) {
-	installables, err := installable.Load(data)
+	wd, err := os.Getwd()
 	if err != nil {
 		return nil, err
 	}
+	return loadFromData(installDir(dir, wd), data)
+}
 
-	if !path.IsAbs(dir) {
-		// TODO(dio): Use git's --show-toplevel
-		dir, err = filepath.Abs(dir)
-		if err != nil {
-			return nil, err
-		}
+// loadFromData loads installable from data, to be installed to dir, an absolute path.
+func loadFromData(dir string, data []byte) (*Box, error) {
+	graph, err := installable.LoadGraph(data)
+	if err != nil {
+		return nil, err
 	}
 
 	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
 		return nil, err
 	}
 
-	names := make([]string, 0, len(installables))
-	for name := range installables {
-		names = append(names, name)
+	lock, err := installable.LoadLock(nil)
+	if err != nil {
+		return nil, err
+	}
+	lock.Frozen, _ = strconv.ParseBool(os.Getenv(FrozenEnv))
+	offline, _ := strconv.ParseBool(os.Getenv(OfflineEnv))
+
+	concurrency, err := strconv.Atoi(os.Getenv(ConcurrencyEnv))
+	if err != nil || concurrency < 1 {
+		concurrency = defaultConcurrency
+	}
+
+	lockTimeout, err := time.ParseDuration(os.Getenv(LockTimeoutEnv))
+	if err != nil || lockTimeout <= 0 {
+		lockTimeout = defaultLockTimeout
+	}
+
+	cache, err := defaultCache()
+	if err != nil {
+		return nil, err
 	}
 
 	return &Box{
-		dir:          dir,
-		names:        names,
-		installables: installables,
+		config:      data,
+		dir:         dir,
+		names:       graph.Names(),
+		graph:       graph,
+		concurrency: concurrency,
+		lockTimeout: lockTimeout,
+		cache:       cache,
+		offline:     offline,
+		lock:        lock,
 	}, nil
 }
 
-// Load loads .magetools.yaml and put the installation destination to dir.
+// Load loads the .magetools.yaml found by FindConfig from the working directory, and puts the
+// installation destination to dir, as LoadFromFile does.
 func Load(dir string) (*Box, error) {
-	data, err := os.ReadFile(".magetools.yaml")
+	file, err := FindConfig(".")
+	if err != nil {
+		return nil, err
+	}
+	return LoadFromFile(dir, file)
+}
+
+// ValidateFile reports every problem of file, e.g. .magetools.yaml, without installing anything,
+// e.g. in a pre-commit hook. Problems are *installable.ConfigError.
+func ValidateFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if data, err = merge(file, data); err == nil {
+		err = installable.Validate(data)
+	}
+	if err != nil {
+		return fmt.Errorf("%s:\n%w", file, err)
+	}
+	return nil
+}
+
+// merge returns data, the content of file, merged with the files it includes. Remote ones are
+// kept in the default cache.
+func merge(file string, data []byte) ([]byte, error) {
+	cache, err := defaultCache()
 	if err != nil {
 		return nil, err
 	}
-	return LoadFromData(dir, data)
+	offline, _ := strconv.ParseBool(os.Getenv(OfflineEnv))
+	return installable.Merge(context.Background(), filepath.Dir(file), data, installable.Options{Cache: cache, Offline: offline})
 }
 
+// ConfigEnv is the environment variable that sets the file boxes are loaded from, instead of
+// finding the nearest .magetools.yaml.
+const ConfigEnv = "MAGETOOLS_CONFIG"
+
+// DirEnv is the environment variable that sets the directory boxes install tools to, overriding
+// the one they are loaded with, e.g. magetools.
+const DirEnv = "MAGETOOLS_DIR"
+
+// FrozenEnv is the environment variable that, when set to true, loads boxes in frozen mode.
+const FrozenEnv = "MAGETOOLS_FROZEN"
+
+// OfflineEnv is the environment variable that, when set to true, loads boxes in offline mode.
+const OfflineEnv = "MAGETOOLS_OFFLINE"
+
+// ConcurrencyEnv is the environment variable that sets how many tools a box installs at a time.
+const ConcurrencyEnv = "MAGETOOLS_CONCURRENCY"
+
+// LockTimeoutEnv is the environment variable that sets how long a box waits for a tool locked by
+// another process, e.g. "5m".
+const LockTimeoutEnv = "MAGETOOLS_LOCK_TIMEOUT"
+
+// CacheDirEnv is the environment variable that sets the directory of the download cache shared
+// across projects. It defaults to installable.DefaultCacheDir().
+const CacheDirEnv = "MAGETOOLS_CACHE_DIR"
+
+// CacheMaxSizeEnv is the environment variable that sets the size the download cache is trimmed
+// to, e.g. "10GB".
+const CacheMaxSizeEnv = "MAGETOOLS_CACHE_MAX_SIZE"
+
+// CacheLinkEnv is the environment variable that, when set to true, hardlinks extracted archives
+// from the download cache instead of extracting them in each project.
+const CacheLinkEnv = "MAGETOOLS_CACHE_LINK"
+
+// CacheTreesEnv is the environment variable that, when set to true, keeps the trees built by
+// installing go:binary and npm:binary tools in the download cache, to reuse them across projects.
+const CacheTreesEnv = "MAGETOOLS_CACHE_TREES"
+
+const (
+	defaultConcurrency = 4
+	defaultLockTimeout = 10 * time.Minute
+)
+
 // Box holds all information given in .magetools.yaml
 type Box struct {
-	dir          string
-	names        []string
-	installables installable.Installables
+	config      []byte
+	dir         string
+	names       []string
+	graph       installable.Graph
+	concurrency int
+	lockTimeout time.Duration
+	retry       *installable.RetryPolicy
+	cache       *installable.Cache
+	offline     bool
+
+	lock       *installable.Lock
+	lockFile   string
+	configFile string
 }
 
+// Config returns the effective configuration of the box, i.e. its .magetools.yaml merged with the
+// files it includes.
+func (b *Box) Config() []byte {
+	return b.config
+}
+
+// SetFrozen sets the frozen mode. In frozen mode, installing a tool fails when the lock and the
+// config disagree, and the lock file is never written.
+func (b *Box) SetFrozen(frozen bool) {
+	b.lock.Frozen = frozen
+}
+
+// SetConcurrency sets how many tools are installed at a time.
+func (b *Box) SetConcurrency(n int) {
+	b.concurrency = max(n, 1)
+}
+
+// SetLockTimeout sets how long to wait for a tool locked by another process, e.g. while another
+// mage process installs it.
+func (b *Box) SetLockTimeout(timeout time.Duration) {
+	b.lockTimeout = timeout
+}
+
+// SetRetryPolicy sets how failed downloads are retried. It defaults to
+// installable.DefaultRetryPolicy.
+func (b *Box) SetRetryPolicy(policy installable.RetryPolicy) {
+	b.retry = &policy
+}
+
+// SetCache sets the download cache. A nil cache disables caching.
+func (b *Box) SetCache(cache *installable.Cache) {
+	b.cache = cache
+}
+
+// Cache returns the download cache, or nil when caching is disabled.
+func (b *Box) Cache() *installable.Cache {
+	return b.cache
+}
+
+// SetOffline sets the offline mode. In offline mode, nothing is downloaded, and installing a tool
+// missing from the cache fails with an error listing every missing artifact.
+func (b *Box) SetOffline(offline bool) {
+	b.offline = offline
+}
+
+func defaultCache() (*installable.Cache, error) {
+	dir := os.Getenv(CacheDirEnv)
+	if dir == "" {
+		var err error
+		if dir, err = installable.DefaultCacheDir(); err != nil {
+			// No home to cache to, e.g. in a bare container.
+			return nil, nil
+		}
+	}
+	cache := installable.NewCache(dir)
+	if maxSize := os.Getenv(CacheMaxSizeEnv); maxSize != "" {
+		size, err := humanize.ParseBytes(maxSize)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", CacheMaxSizeEnv, err)
+		}
+		cache.MaxSize = size
+	}
+	cache.Link, _ = strconv.ParseBool(os.Getenv(CacheLinkEnv))
+	cache.Trees, _ = strconv.ParseBool(os.Getenv(CacheTreesEnv))
+	return cache, nil
+}
+
+// trustDir is where the digests of artifacts trusted on first use are recorded, for the user only,
+// unlike the lock.
+func (b *Box) trustDir() string {
+	return filepath.Join(b.dir, ".trust")
+}
+
+func (b *Box) useLockFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	lock, err := installable.LoadLock(data)
+	if err != nil {
+		return err
+	}
+	lock.Frozen = b.lock.Frozen
+	b.lock = lock
+	b.lockFile = file
+	return nil
+}
+
+func (b *Box) saveLock() error {
+	if b.lockFile == "" || b.lock.Frozen {
+		return nil
+	}
+	b.lock.Retain(b.lockNames())
+	if !b.lock.Changed() {
+		return nil
+	}
+	data, err := b.lock.Marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.lockFile, append([]byte(lockFileHeader), data...), 0o644)
+}
+
+// lockNames returns the names tools are locked as: their names, and name@version for the versions
+// other than the default.
+func (b *Box) lockNames() []string {
+	names := slices.Clone(b.names)
+	for _, versioned := range b.graph.Versions() {
+		if i, _ := b.graph.Get(versioned); !b.graph.IsDefault(i) {
+			names = append(names, versioned)
+		}
+	}
+	return names
+}
+
+const lockFileHeader = "# Code generated by magex. DO NOT EDIT.\n"
+
 // RunWithOption holds option for a running tool.
 type RunWithOption struct {
 	Deps []string
@@ -95,10 +343,11 @@ func (b *Box) Output(ctx context.Context, name string, args ...string) (string,
 
 // OutputWith runs a tools with option and sends back the output.
 func (b *Box) OutputWith(ctx context.Context, opt RunWithOption, name string, args ...string) (string, error) {
-	info, err := b.resolveInstallableInfo(ctx, name, opt.Deps)
+	info, release, err := b.resolveInstallableInfo(ctx, name, opt.Deps)
 	if err != nil {
 		return "", err
 	}
+	defer release()
 	return sh.OutputWith(opt.Env, info.Binary, args...)
 }
 
@@ -109,49 +358,75 @@ func (b *Box) Run(ctx context.Context, name string, args ...string) error {
 
 // RunWith runs a tool with option.
 func (b *Box) RunWith(ctx context.Context, opt RunWithOption, name string, args ...string) error {
-	info, err := b.resolveInstallableInfo(ctx, name, opt.Deps)
+	info, release, err := b.resolveInstallableInfo(ctx, name, opt.Deps)
 	if err != nil {
 		return err
 	}
+	defer release()
 	return sh.RunWithV(opt.Env, info.Binary, args...)
 }
 
-func (b *Box) resolveInstallableInfo(ctx context.Context, name string, deps []string) (installable.Info, error) {
+// resolveInstallableInfo installs name with its deps, and marks the installed versions as in use
+// until release is called, so other processes do not remove them meanwhile.
+func (b *Box) resolveInstallableInfo(ctx context.Context, name string, deps []string) (installable.Info, func(), error) {
 	deps = append(deps, name)
-	p, err := b.Install(ctx, deps...)
-	if err != nil {
-		return installable.Info{}, err
+	p, release, err := b.install(ctx, nil, true, deps...)
+	if err = errors.Join(err, b.saveLock()); err != nil {
+		release()
+		return installable.Info{}, nil, err
 	}
+
 	// TODO(dio): Make it multiplatform.
 	_ = os.Setenv("PATH", p+":"+os.Getenv("PATH"))
-	return b.installables.ResolveInfo(name)
+	info, err := b.graph.ResolveInfo(name)
+	if err != nil {
+		release()
+		return info, nil, err
+	}
+	return info, release, nil
 }
 
-// Install installs names.
+// Install installs names, several at a time, while each runtime is installed before the tools that
+// need it. Errors are reported per tool. The lock file, when there is one, is updated with what was installed.
 func (b *Box) Install(ctx context.Context, names ...string) (string, error) {
-	var paths []string
-	for _, name := range names {
-		name := name
-		info, err := b.installables.ResolveInfo(name)
-		if err != nil {
-			return strings.Join(paths, ":"), err
+	p, _, err := b.install(ctx, nil, false, names...)
+	if err != nil {
+		return p, errors.Join(err, b.saveLock())
+	}
+	return p, b.saveLock()
+}
+
+// install installs names, skipping the tools whose when: condition is not met, on every path, with
+// group("name") met for the groups being installed, if any. With use, the installed versions are
+// kept in use until release is called, even on error.
+func (b *Box) install(ctx context.Context, groups []string, use bool, names ...string) (string, func(), error) {
+	facts := installable.HostFacts(groups...)
+	tasks, err := b.schedule(names, &facts)
+	if err != nil {
+		return "", func() {}, err
+	}
+	for _, t := range tasks {
+		t.use = use
+	}
+	err = b.run(ctx, tasks, b.concurrency)
+
+	paths := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		if t.path != "" {
+			paths = append(paths, t.path)
 		}
-		for _, i := range info.Installers {
-			p, err := i.Install(ctx, b.dir)
-			paths = append(paths, p)
-			if err != nil {
-				baseDir := installedBaseDir(p)
-				if baseDir != "" {
-					_ = os.RemoveAll(installedBaseDir(p))
-				}
-				return strings.Join(paths, ":"), err
+	}
+	release := func() {
+		for _, t := range tasks {
+			if t.release != nil {
+				t.release()
 			}
 		}
 	}
-	return strings.Join(dedupe(paths), ":"), nil
+	return strings.Join(dedupe(paths), ":"), release, err
 }
 
-// InstallAll installs all registered installables.
+// InstallAll installs all registered installables, but the ones whose when: condition is not met.
 func (b *Box) InstallAll(ctx context.Context) error {
 	if _, err := b.Install(ctx, b.names...); err != nil {
 		return err
@@ -159,6 +434,60 @@ func (b *Box) InstallAll(ctx context.Context) error {
 	return nil
 }
 
+// InstallGroup installs the members of group, i.e. the tools listing it in their groups, with
+// their dependencies, as Install does.
+func (b *Box) InstallGroup(ctx context.Context, group string) error {
+	members, err := b.graph.Group(group)
+	if err != nil {
+		return err
+	}
+	_, _, err = b.install(ctx, []string{group}, false, members...)
+	return errors.Join(err, b.saveLock())
+}
+
+// PlannedTool is a tool an installation would install, or skip.
+type PlannedTool struct {
+	Name string
+	// Skipped is the when: condition of the tool, when it is not met, e.g. !ci on CI.
+	Skipped string
+}
+
+// Plan returns the tools installing names would install, or skip, with their dependencies in
+// installation order, without installing anything, i.e. a dry run. All tools are planned when
+// names is empty.
+func (b *Box) Plan(names ...string) ([]PlannedTool, error) {
+	if len(names) == 0 {
+		names = b.names
+	}
+	return b.plan(nil, names)
+}
+
+// PlanGroup returns the tools installing group would install, or skip, as Plan does.
+func (b *Box) PlanGroup(group string) ([]PlannedTool, error) {
+	members, err := b.graph.Group(group)
+	if err != nil {
+		return nil, err
+	}
+	return b.plan([]string{group}, members)
+}
+
+func (b *Box) plan(groups, names []string) ([]PlannedTool, error) {
+	facts := installable.HostFacts(groups...)
+	tasks, err := b.schedule(names, &facts)
+	if err != nil {
+		return nil, err
+	}
+	planned := make([]PlannedTool, 0, len(tasks))
+	for _, t := range tasks {
+		tool := PlannedTool{Name: t.name}
+		if t.skipped != nil {
+			tool.Skipped = t.skipped.String()
+		}
+		planned = append(planned, tool)
+	}
+	return planned, nil
+}
+
 func installedBaseDir(installed string) string {
 	if !strings.Contains(installed, "@v") {
 		return ""
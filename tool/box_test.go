@@ -1,7 +1,12 @@
 package tool
 
 import (
+	"os"
 	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dio/magex/tool/installable"
 )
 
 func TestInstalledBaseDir(t *testing.T) {
@@ -21,3 +26,12 @@ func TestInstalledBaseDir(t *testing.T) {
 		}
 	}
 }
+
+func TestJSONSchema(t *testing.T) {
+	data, err := installable.JSONSchema()
+	require.NoError(t, err)
+	// Regenerate it with mage tools:schema ../magetools.schema.json in example.
+	published, err := os.ReadFile("../magetools.schema.json")
+	require.NoError(t, err)
+	require.Equal(t, string(published), string(data))
+}
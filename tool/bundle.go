@@ -0,0 +1,268 @@
+package tool
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+
+	"github.com/codeclysm/extract/v3"
+
+	"github.com/dio/magex/tool/installable"
+)
+
+// bundleLockFile is the name of the lock in a bundle.
+const bundleLockFile = "magetools.lock"
+
+// Vendor writes to out a gzipped tarball of the artifacts of all tools for platforms, e.g.
+// linux-amd64 and darwin-arm64, along with their lock. It defaults to the host platform. Restore
+// installs the tools from the bundle without network, e.g. in air-gapped environments.
+func (b *Box) Vendor(ctx context.Context, out string, platforms ...string) error {
+	if len(platforms) == 0 {
+		platforms = []string{runtime.GOOS + "-" + runtime.GOARCH}
+	}
+
+	var cache *installable.Cache
+	if b.cache != nil {
+		// Not trimmed until the bundle is written, which would evict the artifacts vendored for
+		// earlier tools or platforms.
+		vendoring := *b.cache
+		vendoring.MaxSize = 0
+		cache = &vendoring
+	} else {
+		dir, err := os.MkdirTemp("", "magetools-vendor-")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = os.RemoveAll(dir)
+		}()
+		cache = installable.NewCache(dir)
+	}
+
+	// Vendoring pins the artifacts of the other platforms too, as pinned by the lock of the box.
+	data, err := b.lock.Marshal()
+	if err != nil {
+		return err
+	}
+	lock, err := installable.LoadLock(data)
+	if err != nil {
+		return err
+	}
+	lock.Frozen = b.lock.Frozen
+
+	// The bundle is installed elsewhere, where conditions are evaluated.
+	tasks, err := b.schedule(b.names, nil)
+	if err != nil {
+		return err
+	}
+	opts := installable.Options{
+		Lock:     lock,
+		Retry:    b.retry,
+		Cache:    cache,
+		Offline:  b.offline,
+		Verify:   b.graph.Verify(),
+		TrustDir: b.trustDir(),
+	}
+	var (
+		files []string
+		errs  []error
+	)
+	for _, t := range tasks {
+		v, ok := t.installer.(installable.Vendorable)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: cannot be vendored", t.name))
+			continue
+		}
+		for _, platform := range platforms {
+			vendored, err := v.Vendor(ctx, platform, opts)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", t.name, err))
+				continue
+			}
+			files = append(files, vendored...)
+		}
+	}
+	if err = errors.Join(errs...); err != nil {
+		return err
+	}
+
+	lock.Retain(b.lockNames())
+	if data, err = lock.Marshal(); err != nil {
+		return err
+	}
+	if err = writeBundle(out, cache.Dir(), dedupe(files), data); err != nil {
+		return err
+	}
+	if b.cache != nil && b.cache.MaxSize > 0 {
+		if _, err = b.cache.Evict(b.cache.MaxSize); err != nil {
+			return err
+		}
+	}
+
+	b.lock.Merge(lock)
+	return b.saveLock()
+}
+
+// Restore installs all tools from a bundle written by Vendor, without network. The artifacts of
+// the bundle are added to the cache, and its lock is merged into the lock of the box.
+func (b *Box) Restore(ctx context.Context, in string) error {
+	if b.cache == nil {
+		return errors.New("restoring a bundle requires a cache")
+	}
+	if err := os.MkdirAll(b.cache.Dir(), os.ModePerm); err != nil {
+		return err
+	}
+	// Extract next to the cache, so the artifacts are moved rather than copied into it.
+	dir, err := os.MkdirTemp(b.cache.Dir(), ".restore-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	f, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	err = extract.Archive(ctx, bufio.NewReader(f), dir, nil)
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+
+	// Artifacts are keyed by their sha256 digest, and found by their other ones too. Their
+	// signatures are verified offline.
+	kinds := []string{path.Join("blobs", "sha256"), path.Join("blobs", "sha384"), path.Join("blobs", "sha512"), "signatures", "trees"}
+	for _, kind := range kinds {
+		entries, err := os.ReadDir(path.Join(dir, kind))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if err = os.MkdirAll(path.Join(b.cache.Dir(), kind), os.ModePerm); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			target := path.Join(b.cache.Dir(), kind, entry.Name())
+			if _, err = os.Stat(target); err == nil {
+				continue
+			}
+			if err = os.Rename(path.Join(dir, kind, entry.Name()), target); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := os.ReadFile(path.Join(dir, bundleLockFile))
+	if err != nil {
+		return err
+	}
+	lock, err := installable.LoadLock(data)
+	if err != nil {
+		return err
+	}
+	b.lock.Merge(lock)
+
+	offline := b.offline
+	b.offline = true
+	defer func() {
+		b.offline = offline
+	}()
+	return b.InstallAll(ctx)
+}
+
+// writeBundle writes to out a gzipped tarball of lock and of files, relative to dir.
+func writeBundle(out, dir string, files []string, lock []byte) (err error) {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(out)
+		}
+	}()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	if err = tw.WriteHeader(&tar.Header{
+		Name: bundleLockFile,
+		Mode: 0o644,
+		Size: int64(len(lock)),
+	}); err != nil {
+		return err
+	}
+	if _, err = tw.Write(lock); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err = addToBundle(tw, dir, file); err != nil {
+			return err
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// addToBundle adds root, relative to dir, and everything under it to tw.
+func addToBundle(tw *tar.Writer, dir, root string) error {
+	return filepath.WalkDir(filepath.Join(dir, root), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if d.Type()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			header.Name += "/"
+		}
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
@@ -0,0 +1,87 @@
+package tool
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dio/magex/tool/installable"
+)
+
+func TestVendorRestore(t *testing.T) {
+	platforms := []string{runtime.GOOS + "-" + runtime.GOARCH, "plan9-mips"}
+	shas := make([]string, 0, len(platforms))
+	for _, platform := range platforms {
+		sum := sha256.Sum256([]byte(platform))
+		shas = append(shas, fmt.Sprintf("        %s: sha256:%s", platform, hex.EncodeToString(sum[:])))
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/")))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, ".magetools.yaml")
+	require.NoError(t, os.WriteFile(config, []byte(`tools:
+  - name: ok
+    type: http:binary
+    version: v1.0.0
+    source: '`+srv.URL+`/{{.OS}}-{{.Arch}}'
+    option:
+      shas:
+`+strings.Join(shas, "\n")+"\n"), 0o644))
+	bundle := filepath.Join(dir, "tools.tar.gz")
+
+	{
+		box, err := LoadFromFile(filepath.Join(dir, "vendor"), config)
+		require.NoError(t, err)
+		// Trimmed only once the bundle is written.
+		cache := installable.NewCache(filepath.Join(dir, "cache"))
+		cache.MaxSize = 1
+		box.SetCache(cache)
+		// Another process downloading the same artifact meanwhile.
+		inflight := filepath.Join(dir, "cache", ".downloads", "ok@v1.0.0-"+platforms[0]+"-inflight")
+		require.NoError(t, os.MkdirAll(filepath.Dir(inflight), os.ModePerm))
+		require.NoError(t, os.WriteFile(inflight, nil, 0o600))
+		require.NoError(t, box.Vendor(context.Background(), bundle, platforms...))
+		require.FileExists(t, inflight)
+		size, err := cache.Size()
+		require.NoError(t, err)
+		require.Zero(t, size)
+
+		data, err := os.ReadFile(filepath.Join(dir, ".magetools.lock"))
+		require.NoError(t, err)
+		for _, platform := range platforms {
+			require.Contains(t, string(data), platform+":")
+		}
+	}
+
+	// Nothing is downloaded when restoring.
+	srv.Close()
+	require.NoError(t, os.Remove(filepath.Join(dir, ".magetools.lock")))
+
+	{
+		box, err := LoadFromFile(filepath.Join(dir, "restore"), config)
+		require.NoError(t, err)
+		box.SetCache(installable.NewCache(filepath.Join(dir, "restored")))
+		require.NoError(t, box.Restore(context.Background(), bundle))
+
+		data, err := os.ReadFile(filepath.Join(dir, "restore", "ok@v1.0.0", "bin", "ok"))
+		require.NoError(t, err)
+		require.Equal(t, platforms[0], string(data))
+
+		data, err = os.ReadFile(filepath.Join(dir, ".magetools.lock"))
+		require.NoError(t, err)
+		require.Contains(t, string(data), "plan9-mips:")
+	}
+}
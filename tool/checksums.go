@@ -0,0 +1,43 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/dio/magex/tool/installable"
+)
+
+// UpdateChecksums downloads the artifacts of names, or of all tools when names is empty, for each
+// platform of their shas, and rewrites the shas in .magetools.yaml. Tools without shas get them
+// for installable.DefaultPlatforms.
+func (b *Box) UpdateChecksums(ctx context.Context, names ...string) error {
+	if b.configFile == "" {
+		return errors.New("updating checksums requires a box loaded from a file")
+	}
+	info, err := os.Stat(b.configFile)
+	if err != nil {
+		return err
+	}
+	opts := installable.Options{Retry: b.retry, Cache: b.cache, Offline: b.offline}
+	updated, err := installable.UpdateFileChecksums(ctx, b.configFile, opts, names...)
+	if err != nil {
+		return err
+	}
+	config, err := installable.Merge(ctx, filepath.Dir(b.configFile), updated, opts)
+	if err != nil {
+		return err
+	}
+	graph, err := installable.LoadGraph(config)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(b.configFile, updated, info.Mode().Perm()); err != nil {
+		return err
+	}
+	b.config = config
+	b.graph = graph
+	b.names = graph.Names()
+	return nil
+}
@@ -0,0 +1,73 @@
+package tool
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ConfigFile is the name of the file a box is loaded from.
+const ConfigFile = ".magetools.yaml"
+
+// FindConfig returns the file a box is loaded from when running in dir: the one set by ConfigEnv,
+// or the nearest .magetools.yaml in dir or its parents, up to the root of the git repository of
+// dir, e.g. when mage runs from a subdirectory.
+func FindConfig(dir string) (string, error) {
+	if file := os.Getenv(ConfigEnv); file != "" {
+		return filepath.Abs(file)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	root := gitRoot(dir)
+	for current := dir; ; current = filepath.Dir(current) {
+		file := filepath.Join(current, ConfigFile)
+		if _, err = os.Stat(file); err == nil {
+			return file, nil
+		}
+		if current == root || current == filepath.Dir(current) {
+			break
+		}
+	}
+	if root == "" {
+		return "", fmt.Errorf("%s not found in %s or its parents", ConfigFile, dir)
+	}
+	return "", fmt.Errorf("%s not found in %s or its parents up to %s", ConfigFile, dir, root)
+}
+
+// gitRoot returns the root of the git repository of dir, an absolute path, i.e. the nearest
+// directory with a .git directory, or a .git file pointing to one for worktrees and submodules.
+// It returns "" outside of a repository.
+func gitRoot(dir string) string {
+	for current := dir; ; current = filepath.Dir(current) {
+		git := filepath.Join(current, ".git")
+		if info, err := os.Stat(git); err == nil {
+			if info.IsDir() {
+				return current
+			}
+			if data, err := os.ReadFile(git); err == nil && bytes.HasPrefix(data, []byte("gitdir:")) {
+				return current
+			}
+		}
+		if current == filepath.Dir(current) {
+			return ""
+		}
+	}
+}
+
+// installDir returns dir, or the one set by DirEnv, absolute: a relative one is relative to the
+// root of the git repository of base, an absolute path, or to base outside of one.
+func installDir(dir, base string) string {
+	if env := os.Getenv(DirEnv); env != "" {
+		dir = env
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	if root := gitRoot(base); root != "" {
+		base = root
+	}
+	return filepath.Join(base, dir)
+}
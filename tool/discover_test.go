@@ -0,0 +1,61 @@
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindConfig(t *testing.T) {
+	t.Setenv(ConfigEnv, "")
+	t.Setenv(DirEnv, "")
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "repo")
+	nested := filepath.Join(repo, "services", "api")
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, ".git"), os.ModePerm))
+	require.NoError(t, os.MkdirAll(nested, os.ModePerm))
+
+	// The search stops at the root of the repository.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ConfigFile), nil, 0o644))
+	_, err := FindConfig(nested)
+	require.ErrorContains(t, err, "not found in "+nested+" or its parents up to "+repo)
+
+	require.NoError(t, os.WriteFile(filepath.Join(repo, ConfigFile), nil, 0o644))
+	file, err := FindConfig(nested)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(repo, ConfigFile), file)
+	require.Equal(t, filepath.Join(repo, "magetools"), installDir("magetools", nested))
+	require.Equal(t, "/opt/magetools", installDir("/opt/magetools", nested))
+
+	// The nearest one wins.
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "services", ConfigFile), nil, 0o644))
+	file, err = FindConfig(nested)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(repo, "services", ConfigFile), file)
+
+	// A worktree, or a submodule, has a .git file.
+	worktree := filepath.Join(dir, "worktree")
+	require.NoError(t, os.MkdirAll(filepath.Join(worktree, "sub"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(worktree, ".git"), []byte("gitdir: "+repo+"/.git/worktrees/worktree\n"), 0o644))
+	require.Equal(t, worktree, gitRoot(filepath.Join(worktree, "sub")))
+	require.Equal(t, filepath.Join(worktree, "magetools"), installDir("magetools", filepath.Join(worktree, "sub")))
+
+	// Outside of a repository, the search goes up to /, and dir is relative to base.
+	outside := filepath.Join(dir, "outside", "sub")
+	require.NoError(t, os.MkdirAll(outside, os.ModePerm))
+	require.Empty(t, gitRoot(outside))
+	file, err = FindConfig(outside)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, ConfigFile), file)
+	require.Equal(t, filepath.Join(outside, "magetools"), installDir("magetools", outside))
+
+	// Both are overridden by the environment.
+	t.Setenv(ConfigEnv, filepath.Join(dir, "other.yaml"))
+	t.Setenv(DirEnv, "/opt/tools")
+	file, err = FindConfig(nested)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "other.yaml"), file)
+	require.Equal(t, "/opt/tools", installDir("magetools", nested))
+}
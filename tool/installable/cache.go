@@ -0,0 +1,496 @@
+package installable
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dio/magex/tool/internal/flock"
+)
+
+// Cache is a content-addressed store of downloaded artifacts keyed by their sha256 digest, and of
+// trees installed from them, shared by all projects of a user. Artifacts are also found by their
+// digests of other algorithms, e.g. sha512, which link to the sha256 one.
+type Cache struct {
+	dir string
+
+	// MaxSize is the size in bytes the cache is trimmed to after each addition. Zero means
+	// unlimited.
+	MaxSize uint64
+	// Link hardlinks extracted archives from the cache into boxes, instead of extracting them
+	// again for each project. Installed files then must not be modified.
+	Link bool
+	// Trees keeps the trees built by installing go:binary and npm:binary tools, e.g. node_modules,
+	// to reuse them in other projects. Only downloaded artifacts are kept otherwise.
+	Trees bool
+}
+
+// NewCache returns a cache stored in dir.
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// DefaultCacheDir returns the default cache directory, e.g. $XDG_CACHE_HOME/magex on Linux.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "magex"), nil
+}
+
+// Dir returns the directory of the cache.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// get returns the cached artifact of digest, which may use another algorithm than sha256, e.g.
+// sha512:<hex>, kept in use until release is called. A cached artifact that does not match its
+// digest anymore is removed.
+func (c *Cache) get(digest string) (blob string, release func(), ok bool) {
+	d, err := parseDigest(digest)
+	if err != nil {
+		return "", nil, false
+	}
+	alias := c.blobPath(d)
+	// Digests of other algorithms are aliases of the sha256 one.
+	blob, err = filepath.EvalSymlinks(alias)
+	if err != nil {
+		_ = os.Remove(alias)
+		return "", nil, false
+	}
+	release, err = c.use(blob)
+	if err != nil {
+		// Being evicted.
+		return "", nil, false
+	}
+	got, err := digestFile(d.algorithm, blob)
+	if err != nil || got.String() != d.String() {
+		release()
+		_ = os.Remove(blob)
+		_ = os.Remove(alias)
+		return "", nil, false
+	}
+	touch(blob)
+	return blob, release, true
+}
+
+// blobMode is the mode of cached artifacts, executable so http:binary tools can be linked to them
+// with Link.
+const blobMode = 0o755
+
+// put adds file as the artifact of digest, its sha256 digest, also found by aliases, its digests
+// of other algorithms. The cache is then trimmed to MaxSize, keeping the artifact.
+func (c *Cache) put(digest, file string, aliases ...string) error {
+	blob, ok := c.blob(digest)
+	if !ok {
+		return nil
+	}
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err = os.MkdirAll(path.Dir(blob), os.ModePerm); err != nil {
+		return err
+	}
+	if err = linkOrCopy(file, blob); err != nil {
+		return err
+	}
+	// Once, before anything links to it.
+	if err = os.Chmod(blob, blobMode); err != nil {
+		return err
+	}
+	touch(blob)
+	for _, alias := range aliases {
+		d, err := parseDigest(alias)
+		if err != nil || d.algorithm == "sha256" {
+			continue
+		}
+		if err = c.alias(c.blobPath(d), blob); err != nil {
+			return err
+		}
+	}
+	if c.MaxSize > 0 {
+		_, err = c.evict(c.MaxSize, blob)
+		return err
+	}
+	return nil
+}
+
+// cacheLockTimeout is how long adding to or trimming the cache waits for other processes doing
+// the same.
+const cacheLockTimeout = 10 * time.Minute
+
+// lock locks the cache exclusively, while adding to or trimming it.
+func (c *Cache) lock() (func(), error) {
+	return flock.Lock(context.Background(), path.Join(c.dir, ".locks", "cache.lock"), true, cacheLockTimeout)
+}
+
+// use marks entry, an artifact or a tree, as in use until release is called, so it is not
+// evicted meanwhile. It fails with flock.ErrLocked while entry is being evicted.
+func (c *Cache) use(entry string) (func(), error) {
+	return flock.TryLock(c.useLockFile(entry), false)
+}
+
+func (c *Cache) useLockFile(entry string) string {
+	return path.Join(c.dir, ".locks", path.Base(entry)+".lock")
+}
+
+// alias links alias to blob, replacing a previous alias.
+func (c *Cache) alias(alias, blob string) error {
+	if err := os.MkdirAll(path.Dir(alias), os.ModePerm); err != nil {
+		return err
+	}
+	target, err := filepath.Rel(path.Dir(alias), blob)
+	if err != nil {
+		return err
+	}
+	tmp := alias + ".tmp"
+	_ = os.Remove(tmp)
+	if err = os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, alias)
+}
+
+// blobDigest returns the sha256 digest of blob, as returned by get.
+func blobDigest(blob string) string {
+	return "sha256:" + path.Base(blob)
+}
+
+// findTree returns the cached tree of key, kept in use until release is called.
+func (c *Cache) findTree(key string) (tree string, release func(), ok bool) {
+	if c == nil {
+		return "", nil, false
+	}
+	tree = c.treeDir(key)
+	release, err := c.use(tree)
+	if err != nil {
+		// Being evicted.
+		return "", nil, false
+	}
+	if _, err = os.Stat(tree); err != nil {
+		release()
+		return "", nil, false
+	}
+	touch(tree)
+	return tree, release, true
+}
+
+// putTree adds a copy of dir as the tree of key, when the cache keeps Trees.
+func (c *Cache) putTree(key, dir string) error {
+	if c == nil || !c.Trees {
+		return nil
+	}
+	_, release, err := c.tree(key, func(tree string) error {
+		return copyTree(dir, tree, c.Link)
+	})
+	if err != nil {
+		return err
+	}
+	release()
+	return nil
+}
+
+// tree returns the cached tree of key, building it first when it is missing, kept in use until
+// release is called.
+func (c *Cache) tree(key string, build func(dir string) error) (string, func(), error) {
+	if tree, release, ok := c.findTree(key); ok {
+		return tree, release, nil
+	}
+	tree := c.treeDir(key)
+	if err := os.MkdirAll(path.Dir(tree), os.ModePerm); err != nil {
+		return "", nil, err
+	}
+	staging, err := os.MkdirTemp(path.Dir(tree), ".staging-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(staging)
+	}()
+	if err = os.Chmod(staging, 0o755); err != nil {
+		return "", nil, err
+	}
+	if err = build(staging); err != nil {
+		return "", nil, err
+	}
+	// In use before it appears, so it is not evicted before being returned.
+	release, err := flock.Lock(context.Background(), c.useLockFile(tree), false, cacheLockTimeout)
+	if err != nil {
+		return "", nil, err
+	}
+	if err = os.Rename(staging, tree); err != nil {
+		// Another process may have built the same tree meanwhile.
+		if _, statErr := os.Stat(tree); statErr != nil {
+			release()
+			return "", nil, err
+		}
+	}
+	touch(tree)
+	return tree, release, nil
+}
+
+func (c *Cache) treeDir(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return path.Join(c.dir, "trees", hex.EncodeToString(sum[:]))
+}
+
+func (c *Cache) blob(digest string) (string, bool) {
+	d, err := parseDigest(digest)
+	if err != nil || d.algorithm != "sha256" {
+		return "", false
+	}
+	return c.blobPath(d), true
+}
+
+func (c *Cache) blobPath(d digest) string {
+	return path.Join(c.dir, "blobs", d.algorithm, hex.EncodeToString(d.sum))
+}
+
+// signaturePath returns where the signature of type typ, e.g. minisign, of the artifact of digest d
+// is kept, or "" without a cache.
+func (c *Cache) signaturePath(d digest, typ string) string {
+	if c == nil {
+		return ""
+	}
+	return path.Join(c.dir, "signatures", hex.EncodeToString(d.sum)+"."+typ)
+}
+
+// signatures returns the signatures kept for blob.
+func (c *Cache) signatures(blob string) []string {
+	signatures, _ := filepath.Glob(path.Join(c.dir, "signatures", path.Base(blob)+".*"))
+	return signatures
+}
+
+// putSignature keeps sig, the verified signature of type typ of the artifact of digest d.
+func (c *Cache) putSignature(d digest, typ string, sig []byte) error {
+	if c == nil {
+		return nil
+	}
+	file := c.signaturePath(d, typ)
+	if err := os.MkdirAll(path.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(path.Dir(file), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(sig)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Size returns the size of the cache in bytes.
+func (c *Cache) Size() (uint64, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return 0, err
+	}
+	var size uint64
+	for _, e := range entries {
+		size += e.size
+	}
+	return size, nil
+}
+
+// Evict removes the least recently used artifacts and trees until the cache is no larger than
+// maxSize bytes, and returns the number of bytes reclaimed. Evict(0) empties the cache, but the
+// artifacts and trees in use, e.g. by another process installing from them.
+func (c *Cache) Evict(maxSize uint64) (uint64, error) {
+	unlock, err := c.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	return c.evict(maxSize, "")
+}
+
+// evict evicts as Evict does, but keep, with the cache locked.
+func (c *Cache) evict(maxSize uint64, keep string) (uint64, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].used.Before(entries[j].used)
+	})
+	var size uint64
+	for _, e := range entries {
+		size += e.size
+	}
+	var reclaimed uint64
+	for _, e := range entries {
+		if size <= maxSize {
+			break
+		}
+		if e.path == keep {
+			continue
+		}
+		unlock, err := flock.TryLock(c.useLockFile(e.path), true)
+		if errors.Is(err, flock.ErrLocked) {
+			continue
+		}
+		if err != nil {
+			return reclaimed, err
+		}
+		err = os.RemoveAll(e.path)
+		for _, signature := range c.signatures(e.path) {
+			_ = os.Remove(signature)
+		}
+		unlock()
+		if err != nil {
+			return reclaimed, err
+		}
+		size -= e.size
+		reclaimed += e.size
+	}
+	return reclaimed, nil
+}
+
+type cacheEntry struct {
+	path string
+	size uint64
+	used time.Time
+}
+
+func (c *Cache) entries() ([]cacheEntry, error) {
+	var entries []cacheEntry
+	for _, dir := range []string{path.Join(c.dir, "blobs", "sha256"), path.Join(c.dir, "trees")} {
+		items, err := os.ReadDir(dir)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		for _, item := range items {
+			if strings.HasPrefix(item.Name(), ".") {
+				continue
+			}
+			info, err := item.Info()
+			if err != nil {
+				return nil, err
+			}
+			size, err := DiskUsage(path.Join(dir, item.Name()))
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, cacheEntry{path: path.Join(dir, item.Name()), size: size, used: info.ModTime()})
+		}
+	}
+	return entries, nil
+}
+
+// DiskUsage returns the size in bytes of the files in root.
+func DiskUsage(root string) (uint64, error) {
+	var size uint64
+	err := filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	return size, err
+}
+
+// touch marks file as recently used.
+func touch(file string) {
+	now := time.Now()
+	_ = os.Chtimes(file, now, now)
+}
+
+// linkOrCopy hardlinks src to dst, or copies it when they are on different filesystems. dst only
+// appears once complete.
+func linkOrCopy(src, dst string) error {
+	tmp, err := os.CreateTemp(path.Dir(dst), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_ = tmp.Close()
+	_ = os.Remove(tmp.Name())
+	if err = os.Link(src, tmp.Name()); err != nil {
+		if err = copyFile(src, tmp.Name()); err != nil {
+			_ = os.Remove(tmp.Name())
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copyTree recreates the tree of src in dst, copying or hardlinking its files.
+func copyTree(src, dst string, link bool) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, os.ModePerm)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			if link && os.Link(p, target) == nil {
+				return nil
+			}
+			return copyFile(p, target)
+		}
+	})
+}
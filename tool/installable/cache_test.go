@@ -0,0 +1,194 @@
+package installable
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	content := []byte("#!/bin/sh\necho kubectl\n")
+	sum := sha256.Sum256(content)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	cache := NewCache(t.TempDir())
+	bin := &httpBinary{
+		name:      "kubectl",
+		version:   "v1.28.1",
+		versioned: "kubectl@v1.28.1",
+		source:    srv.URL + "/{{ .Version }}/kubectl",
+		option:    httpBinaryOption{SHAs: map[string]string{hostPlatform: digest}},
+	}
+
+	// Two projects, one download.
+	for _, dst := range []string{t.TempDir(), t.TempDir()} {
+		installed, err := bin.Install(context.Background(), dst, Options{Cache: cache})
+		require.NoError(t, err)
+		data, err := os.ReadFile(path.Join(installed, "kubectl"))
+		require.NoError(t, err)
+		require.Equal(t, content, data)
+	}
+	require.Equal(t, 1, requests)
+
+	// Offline, only the cache is consulted.
+	_, err := bin.Install(context.Background(), t.TempDir(), Options{Cache: cache, Offline: true})
+	require.NoError(t, err)
+	_, err = bin.Install(context.Background(), t.TempDir(), Options{Cache: NewCache(t.TempDir()), Offline: true})
+	var missing *MissingArtifactError
+	require.ErrorAs(t, err, &missing)
+	require.Equal(t, MissingArtifactError{Tool: "kubectl@v1.28.1", Platform: hostPlatform, Source: srv.URL + "/v1.28.1/kubectl"}, *missing)
+	require.ErrorIs(t, err, ErrOffline)
+	require.Equal(t, 1, requests)
+
+	// A corrupted artifact is dropped, and downloaded again.
+	blob, ok := cache.blob(digest)
+	require.True(t, ok)
+	require.NoError(t, os.WriteFile(blob, []byte("corrupted"), 0o600))
+	_, _, ok = cache.get(digest)
+	require.False(t, ok)
+	_, err = bin.Install(context.Background(), t.TempDir(), Options{Cache: cache})
+	require.NoError(t, err)
+	require.Equal(t, 2, requests)
+
+	// The least recently used artifact is evicted first.
+	other := path.Join(t.TempDir(), "other")
+	require.NoError(t, os.WriteFile(other, []byte("other"), 0o600))
+	otherSum := sha256.Sum256([]byte("other"))
+	otherDigest := "sha256:" + hex.EncodeToString(otherSum[:])
+	require.NoError(t, cache.put(otherDigest, other))
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(blob, old, old))
+
+	size, err := cache.Size()
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(content)+len("other")), size)
+	reclaimed, err := cache.Evict(uint64(len("other")))
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(content)), reclaimed)
+	_, _, ok = cache.get(digest)
+	require.False(t, ok)
+	_, release, ok := cache.get(otherDigest)
+	require.True(t, ok)
+	release()
+}
+
+func TestCacheEvictInUse(t *testing.T) {
+	cache := NewCache(t.TempDir())
+	put := func(content string) string {
+		file := path.Join(t.TempDir(), "file")
+		require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+		sum := sha256.Sum256([]byte(content))
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+		require.NoError(t, cache.put(digest, file))
+		return digest
+	}
+	used := put("used")
+	tree, releaseTree, err := cache.tree("tree", func(dir string) error {
+		return os.WriteFile(path.Join(dir, "file"), []byte("tree"), 0o600)
+	})
+	require.NoError(t, err)
+
+	// In use, so kept.
+	_, release, ok := cache.get(used)
+	require.True(t, ok)
+	reclaimed, err := cache.Evict(0)
+	require.NoError(t, err)
+	require.Zero(t, reclaimed)
+	_, err = os.Stat(tree)
+	require.NoError(t, err)
+
+	release()
+	releaseTree()
+	reclaimed, err = cache.Evict(0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(len("used")+len("tree")), reclaimed)
+	_, _, ok = cache.get(used)
+	require.False(t, ok)
+
+	// The artifact just put is kept, even beyond MaxSize.
+	cache.MaxSize = 1
+	old := put("old")
+	added := put("added")
+	_, _, ok = cache.get(old)
+	require.False(t, ok)
+	_, release, ok = cache.get(added)
+	require.True(t, ok)
+	release()
+}
+
+func TestCacheTrees(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(dir, "file"), []byte("built"), 0o600))
+
+	// Only kept when opted in.
+	cache := NewCache(t.TempDir())
+	require.NoError(t, cache.putTree("key", dir))
+	_, _, ok := cache.findTree("key")
+	require.False(t, ok)
+
+	cache.Trees = true
+	require.NoError(t, cache.putTree("key", dir))
+	tree, release, ok := cache.findTree("key")
+	require.True(t, ok)
+	defer release()
+	data, err := os.ReadFile(path.Join(tree, "file"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("built"), data)
+}
+
+func TestCacheLinkBinary(t *testing.T) {
+	content := []byte("#!/bin/sh\necho kubectl\n")
+	sum := sha256.Sum256(content)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	cache := NewCache(t.TempDir())
+	cache.Link = true
+	bin := &httpBinary{
+		name:      "kubectl",
+		version:   "v1.28.1",
+		versioned: "kubectl@v1.28.1",
+		source:    srv.URL + "/kubectl",
+		option:    httpBinaryOption{SHAs: map[string]string{hostPlatform: digest}},
+	}
+	installed, err := bin.Install(context.Background(), t.TempDir(), Options{Cache: cache})
+	require.NoError(t, err)
+	blob, ok := cache.blob(digest)
+	require.True(t, ok)
+	blobInfo, err := os.Stat(blob)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(blobMode), blobInfo.Mode().Perm())
+	info, err := os.Stat(path.Join(installed, "kubectl"))
+	require.NoError(t, err)
+	require.True(t, os.SameFile(blobInfo, info))
+
+	// An artifact of another mode is copied, rather than changing the mode of the shared artifact.
+	require.NoError(t, os.Chmod(blob, 0o644))
+	installed, err = bin.Install(context.Background(), t.TempDir(), Options{Cache: cache})
+	require.NoError(t, err)
+	info, err = os.Stat(path.Join(installed, "kubectl"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+	blobInfo, err = os.Stat(blob)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o644), blobInfo.Mode().Perm())
+	require.False(t, os.SameFile(blobInfo, info))
+}
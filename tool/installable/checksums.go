@@ -0,0 +1,258 @@
+package installable
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPlatforms are the platforms UpdateChecksums computes shas for, when an entry has none.
+var DefaultPlatforms = []string{"darwin-amd64", "darwin-arm64", "linux-amd64", "linux-arm64"}
+
+// Checksummed is implemented by installables downloading artifacts verified against shas.
+type Checksummed interface {
+	// Source returns the URL of the artifact for platform, e.g. linux-arm64.
+	Source(platform string) (string, error)
+	// Platforms returns the platforms of the shas of the installable.
+	Platforms() []string
+}
+
+// UpdateChecksums downloads the artifacts of the checksummed entries of names, or of all entries
+// when names is empty, for each platform of their shas, or DefaultPlatforms when they have none,
+// and returns data with their shas rewritten. Comments and ordering are kept.
+func UpdateChecksums(ctx context.Context, data []byte, opts Options, names ...string) ([]byte, error) {
+	return updateChecksums(ctx, data, nil, data, opts, names...)
+}
+
+// UpdateFileChecksums is UpdateChecksums for file, including other files. An entry overriding an
+// included one is checksummed as merged with it, and gets the shas of all of its platforms.
+func UpdateFileChecksums(ctx context.Context, file string, opts Options, names ...string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err = yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return data, nil
+	}
+	dir := filepath.Dir(file)
+	base, err := mergeIncludes(ctx, dir, doc.Content[0], opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := Merge(ctx, dir, data, opts)
+	if err != nil {
+		return nil, err
+	}
+	return updateChecksums(ctx, data, mappingValue(base, "tools"), merged, opts, names...)
+}
+
+// updateChecksums updates the shas of data, whose entries override the ones of included, if any,
+// as merged in merged.
+func updateChecksums(ctx context.Context, data []byte, included *yaml.Node, merged []byte, opts Options, names ...string) ([]byte, error) {
+	if opts.Offline {
+		return nil, fmt.Errorf("computing checksums: %w", ErrOffline)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return data, nil
+	}
+	tools := mappingValue(doc.Content[0], "tools")
+	if tools == nil || tools.Kind != yaml.SequenceNode {
+		return data, nil
+	}
+
+	all := new(entries)
+	if err := yaml.Unmarshal(merged, all); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, node := range tools.Content {
+		effective := node
+		if included != nil {
+			if overridden := lastEntry(included.Content, mappingValue(node, "name")); overridden != nil {
+				effective = copyNode(overridden)
+				overrideEntry(effective, node)
+			}
+		}
+		var e Entry
+		if err := effective.Decode(&e); err != nil {
+			return nil, err
+		}
+		if len(names) > 0 && !slices.Contains(names, e.Name) && !slices.Contains(names, e.Versioned()) {
+			continue
+		}
+		resolved, err := e.resolve(all)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		c, ok := resolved.(Checksummed)
+		if !ok {
+			continue
+		}
+		platforms := c.Platforms()
+		if len(platforms) == 0 {
+			platforms = DefaultPlatforms
+		}
+		existing := mappingValue(mappingValue(effective, "option"), "shas")
+		shas := make(map[string]string, len(platforms))
+		for _, platform := range platforms {
+			var like string
+			if value := mappingValue(existing, platform); value != nil {
+				like = value.Value
+			}
+			digest, err := digestOf(ctx, c, e.Versioned(), platform, like, opts)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s for %s: %w", e.Versioned(), platform, err))
+				continue
+			}
+			shas[platform] = digest
+		}
+		if err = setSHAs(node, shas); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.Versioned(), err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var updated bytes.Buffer
+	encoder := yaml.NewEncoder(&updated)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return updated.Bytes(), nil
+}
+
+// digestOf downloads the artifact of c for platform, and returns its digest with the algorithm and
+// encoding of like, the existing sha, or else its sha256 digest. The artifact is kept in
+// opts.Cache, if any.
+func digestOf(ctx context.Context, c Checksummed, versioned, platform, like string, opts Options) (string, error) {
+	source, err := c.Source(platform)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "magetools-checksum-")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	downloaded, digest, err := download(ctx, dir, source, versioned+"-"+platform, opts.retryPolicy())
+	if err != nil {
+		return "", err
+	}
+	algorithm, sri := digestStyle(like)
+	computed, err := digestFile(algorithm, downloaded)
+	if err != nil {
+		return "", err
+	}
+	computed.sri = sri
+	if opts.Cache != nil {
+		if err = opts.Cache.put(digest, downloaded, computed.format()); err != nil {
+			return "", err
+		}
+	}
+	return computed.format(), nil
+}
+
+// digestStyle returns the algorithm and encoding of the existing sha like, defaulting to sha256.
+func digestStyle(like string) (string, bool) {
+	if algorithm, _, ok := strings.Cut(like, ":"); ok && digestAlgorithms[algorithm] != nil {
+		return algorithm, false
+	}
+	if algorithm, _, ok := strings.Cut(like, "-"); ok && digestAlgorithms[algorithm] != nil {
+		return algorithm, true
+	}
+	return "sha256", false
+}
+
+// setSHAs sets the option.shas of the entry of node, keeping the order of existing platforms. Added
+// platforms are sorted.
+func setSHAs(node *yaml.Node, shas map[string]string) error {
+	if node.Kind != yaml.MappingNode {
+		return ErrEntryInvalid
+	}
+	option := mappingValue(node, "option")
+	if option == nil || option.Kind != yaml.MappingNode {
+		option = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		setMappingValue(node, "option", option)
+	}
+	values := mappingValue(option, "shas")
+	if values == nil || values.Kind != yaml.MappingNode {
+		values = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		setMappingValue(option, "shas", values)
+	}
+	if len(values.Content) == 0 {
+		// An empty {} is filled as a block.
+		values.Style &^= yaml.FlowStyle
+	}
+
+	platforms := make([]string, 0, len(shas))
+	for platform := range shas {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+	for _, platform := range platforms {
+		if existing := mappingValue(values, platform); existing != nil {
+			existing.Kind, existing.Tag, existing.Value = yaml.ScalarNode, "!!str", shas[platform]
+			continue
+		}
+		setMappingValue(values, platform, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: shas[platform]})
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in the mapping node, or nil when it is missing.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		if node.Content[idx].Value == key {
+			return node.Content[idx+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets the value of key in the mapping node, appending it when missing.
+func setMappingValue(node *yaml.Node, key string, value *yaml.Node) {
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		if node.Content[idx].Value == key {
+			node.Content[idx+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,90 @@
+package installable
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateChecksums(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+	sha := func(path string) string {
+		sum := sha256.Sum256([]byte(path))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+	// Existing shas keep their algorithm and encoding.
+	sri := func(path string) string {
+		sum := sha512.Sum512([]byte(path))
+		return "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	data := []byte(`tools:
+  # kubectl is the Kubernetes CLI.
+  - name: kubectl
+    type: http:binary
+    version: v1.28.1
+    source: '` + srv.URL + `/kubectl/{{ .Version }}/{{ .OS }}/{{ .Arch }}'
+    option:
+      shas:
+        linux-arm64: sha256:stale # arm
+        darwin-arm64: sha512-stale
+  - name: kind
+    type: http:binary
+    version: v0.20.0
+    source: '` + srv.URL + `/kind/{{ .OS }}-{{ .Arch }}'
+  - name: gosimports
+    type: go:binary
+    version: v0.3.5
+    source: github.com/rinchsan/gosimports/cmd/gosimports
+`)
+	opts := Options{Retry: &RetryPolicy{Attempts: 1, Backoff: time.Millisecond}}
+
+	updated, err := UpdateChecksums(context.Background(), data, opts)
+	require.NoError(t, err)
+	require.Equal(t, `tools:
+  # kubectl is the Kubernetes CLI.
+  - name: kubectl
+    type: http:binary
+    version: v1.28.1
+    source: '`+srv.URL+`/kubectl/{{ .Version }}/{{ .OS }}/{{ .Arch }}'
+    option:
+      shas:
+        linux-arm64: `+sha("/kubectl/v1.28.1/linux/arm64")+` # arm
+        darwin-arm64: `+sri("/kubectl/v1.28.1/darwin/arm64")+`
+  - name: kind
+    type: http:binary
+    version: v0.20.0
+    source: '`+srv.URL+`/kind/{{ .OS }}-{{ .Arch }}'
+    option:
+      shas:
+        darwin-amd64: `+sha("/kind/darwin-amd64")+`
+        darwin-arm64: `+sha("/kind/darwin-arm64")+`
+        linux-amd64: `+sha("/kind/linux-amd64")+`
+        linux-arm64: `+sha("/kind/linux-arm64")+`
+  - name: gosimports
+    type: go:binary
+    version: v0.3.5
+    source: github.com/rinchsan/gosimports/cmd/gosimports
+`, string(updated))
+
+	// Only the named entries are updated.
+	updated, err = UpdateChecksums(context.Background(), data, opts, "kind")
+	require.NoError(t, err)
+	require.Contains(t, string(updated), "linux-arm64: sha256:stale # arm")
+	require.Contains(t, string(updated), sha("/kind/linux-arm64"))
+
+	srv.Close()
+	_, err = UpdateChecksums(context.Background(), data, opts, "kind")
+	require.ErrorContains(t, err, "kind@v0.20.0 for darwin-amd64")
+}
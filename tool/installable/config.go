@@ -2,6 +2,10 @@ package installable
 
 import (
 	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -12,103 +16,296 @@ var ErrEntryInvalid = errors.New("invalid entry")
 // ErrEntryNotFound notifies not foun entry.
 var ErrEntryNotFound = errors.New("not found entry")
 
-type entry struct {
-	Name    string      `yaml:"name"`
-	Version string      `yaml:"version"`
-	Source  string      `yaml:"source"`
-	Type    string      `yaml:"type"`
-	Option  interface{} `yaml:"option"`
+// Entry is a tool as declared in a .magetools.yaml file.
+type Entry struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+	Source  string `yaml:"source"`
+	Type    string `yaml:"type"`
+	// Option is the raw option of the entry, see DecodeOption.
+	Option interface{} `yaml:"option"`
+	// Deps are the names of the entries to install first, besides the runtime of the entry, if
+	// any, e.g. buf, or buf@v1.26.1 for a version other than the default.
+	Deps []string `yaml:"deps"`
+	// Groups are the names of the groups the entry belongs to, to install only some entries, see
+	// Graph.Group.
+	Groups []string `yaml:"groups"`
+	// When is the condition the entry is installed on, see Condition, e.g. os == "linux".
+	When string `yaml:"when"`
+
+	all *entries
+	// node is the node the entry is decoded from, if any, to locate its problems.
+	node *yaml.Node
+}
+
+// UnmarshalYAML decodes the entry, keeping its node.
+func (e *Entry) UnmarshalYAML(node *yaml.Node) error {
+	type plain Entry
+	if err := node.Decode((*plain)(e)); err != nil {
+		return err
+	}
+	e.node = node
+	return nil
 }
 
-func (e *entry) resolve(all *entries) (Installable, error) {
-	switch e.Type {
-	case goBinaryType:
-		opt, err := typedOption[goBinaryOption](*e)
-		if err != nil {
-			return nil, err
+// DecodeOption decodes the option of the entry into v, a pointer to a struct with yaml tags.
+func (e Entry) DecodeOption(v interface{}) error {
+	if option := mappingValue(e.node, "option"); option != nil {
+		if errs := checkFields(option, reflect.TypeOf(v), "option"); len(errs) > 0 {
+			return errors.Join(errs...)
 		}
-		return &goBinary{
-			name:      e.Name,
-			source:    e.Source,
-			version:   e.Version,
-			versioned: versioned(*e),
-			option:    *opt,
-		}, nil
-	case httpArchiveType:
-		opt, err := typedOption[httpArchiveOption](*e)
-		if err != nil {
-			return nil, err
+		// Decoding the node keeps the lines of errors.
+		return option.Decode(v)
+	}
+	b, err := yaml.Marshal(e.Option)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(b, v)
+}
+
+// Resolve resolves another entry of the same file by name, e.g. a runtime.
+func (e Entry) Resolve(name string) (Installable, error) {
+	if e.all == nil {
+		return nil, ErrEntryNotFound
+	}
+	return e.all.resolve(name)
+}
+
+// Versioned returns the name of the entry with its version, e.g. buf@v1.26.1, which is the
+// directory it is installed to.
+func (e Entry) Versioned() string {
+	return e.Name + "@" + e.Version
+}
+
+func (e *Entry) resolve(all *entries) (Installable, error) {
+	factory, ok := lookup(e.Type)
+	if !ok {
+		return nil, &ConfigError{
+			Entry:      e.Name,
+			Field:      "type",
+			Err:        fmt.Errorf("unknown type %q", e.Type),
+			Suggestion: suggest(e.Type, Types()),
 		}
-		return &httpArchive{
-			name:      e.Name,
-			source:    e.Source,
-			version:   e.Version,
-			versioned: versioned(*e),
-			option:    *opt,
-		}, nil
-	case httpBinaryType:
-		opt, err := typedOption[httpBinaryOption](*e)
-		if err != nil {
-			return nil, err
+	}
+	resolved := *e
+	resolved.all = all
+	return factory(resolved)
+}
+
+// configErrors returns err, a problem of the entry, as located config errors.
+func (e Entry) configErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		if _, ok = err.(*ConfigError); !ok {
+			var errs []error
+			for _, err := range joined.Unwrap() {
+				errs = append(errs, e.configErrors(err)...)
+			}
+			return errs
+		}
+	}
+
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		// The option does not decode, e.g. a string given for a map.
+		errs := make([]error, 0, len(typeErr.Errors))
+		for _, message := range typeErr.Errors {
+			configErr := &ConfigError{Entry: e.Name, Field: "option", Err: errors.New(message)}
+			if line, rest, ok := strings.Cut(message, ": "); ok {
+				if _, scanErr := fmt.Sscanf(line, "line %d", &configErr.Line); scanErr == nil {
+					configErr.Err = errors.New(rest)
+				}
+			}
+			if configErr.Line == 0 {
+				configErr.locate(e.node)
+			}
+			errs = append(errs, configErr)
+		}
+		return errs
+	}
+
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		configErr = &ConfigError{Err: err}
+	}
+	if configErr.Entry == "" {
+		configErr.Entry = e.Name
+	}
+	if configErr.Line == 0 && configErr.Entry == e.Name {
+		configErr.locate(e.node)
+	}
+	return []error{configErr}
+}
+
+// ConfigError is a problem of a .magetools.yaml file, located at its line and column when known.
+// It matches ErrEntryInvalid.
+type ConfigError struct {
+	// Entry is the name of the entry with the problem, if any.
+	Entry string
+	// Field is the path of the offending field in the entry, e.g. type or option.verify.
+	Field  string
+	Line   int
+	Column int
+	Err    error
+	// Suggestion is a hint to fix the problem, e.g. the closest known type.
+	Suggestion string
+}
+
+func (e *ConfigError) Error() string {
+	var b strings.Builder
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "line %d", e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&b, ", column %d", e.Column)
+		}
+		b.WriteString(": ")
+	}
+	for _, prefix := range []string{e.Entry, e.Field} {
+		if prefix != "" {
+			b.WriteString(prefix + ": ")
+		}
+	}
+	b.WriteString(e.Err.Error())
+	if e.Suggestion != "" {
+		b.WriteString(", " + e.Suggestion)
+	}
+	return b.String()
+}
+
+func (e *ConfigError) Unwrap() []error {
+	return []error{ErrEntryInvalid, e.Err}
+}
+
+// locate sets the line and column of the field in node, or of its closest parent.
+func (e *ConfigError) locate(node *yaml.Node) {
+	if node == nil {
+		return
+	}
+	e.Line, e.Column = node.Line, node.Column
+	if e.Field == "" {
+		return
+	}
+	for _, key := range strings.Split(e.Field, ".") {
+		if node = mappingValue(node, key); node == nil {
+			return
 		}
-		return &httpBinary{
-			name:      e.Name,
-			source:    e.Source,
-			version:   e.Version,
-			versioned: versioned(*e),
-			option:    *opt,
-		}, nil
-	case npmBinaryType:
-		opt, err := typedOption[npmBinaryOption](*e)
-		if err != nil {
-			return nil, err
+		e.Line, e.Column = node.Line, node.Column
+	}
+}
+
+// suggest returns a hint naming the candidate closest to word, if any is close enough.
+func suggest(word string, candidates []string) string {
+	best, bestDistance := "", max(2, len(word)/3)+1
+	for _, candidate := range candidates {
+		distance := levenshtein(word, candidate)
+		if word != "" && strings.HasPrefix(candidate, word) {
+			distance = 0
 		}
-		bin := &npmBinary{
-			name:      e.Name,
-			source:    e.Source,
-			version:   e.Version,
-			versioned: versioned(*e),
-			option:    *opt,
+		if distance < bestDistance {
+			best, bestDistance = candidate, distance
 		}
-		if all != nil && opt.Runtime != "" {
-			// Use system runtime, e.g. node installed in the os instead of local installed binaries.
-			bin.runtime, _ = all.resolve(opt.Runtime)
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf("did you mean %q?", best)
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
 		}
-		return bin, nil
+		previous = current
 	}
-	return nil, ErrEntryInvalid
+	return previous[len(b)]
 }
 
 // entries hold tools data in a .magetools.yaml file.
 type entries struct {
-	Data []entry `yaml:"tools"`
+	Data []Entry `yaml:"tools"`
+	// Verify is how artifacts without a digest are installed, unless their entry sets it.
+	Verify VerifyPolicy `yaml:"verify"`
+	// Include lists the files merged before this one, see Merge.
+	Include []include `yaml:"include"`
+
+	// resolved memoizes resolved entries by index, so a runtime shared by several tools is the
+	// same installable, and installed only once.
+	resolved map[int]Installable
+	// resolving lists the entries being resolved, by index, to detect runtime cycles.
+	resolving []int
 }
 
+// resolve resolves the entry of name. The last entry of a name wins.
 func (e *entries) resolve(name string) (Installable, error) {
-	for _, i := range e.Data {
-		if i.Name == name {
-			return i.resolve(e)
-		}
-	}
-	return nil, ErrEntryNotFound
+	return e.resolveVersion(name, "")
 }
 
-func typedOption[T option](e entry) (*T, error) {
-	opt := new(T)
-	if err := fromUntypedOption[T](e.Option, opt); err != nil {
+// resolveVersion resolves the entry of name at version, or the last entry of name when version is
+// empty.
+func (e *entries) resolveVersion(name, version string) (Installable, error) {
+	idx, ok := e.find(name, version)
+	if !ok {
+		return nil, ErrEntryNotFound
+	}
+	if resolved, ok := e.resolved[idx]; ok {
+		return resolved, nil
+	}
+	if start := slices.Index(e.resolving, idx); start >= 0 {
+		names := make([]string, 0, len(e.resolving)-start+1)
+		for _, resolving := range e.resolving[start:] {
+			names = append(names, e.Data[resolving].Name)
+		}
+		configErr := &ConfigError{
+			Entry: name,
+			Err:   fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(append(names, name), " -> ")),
+		}
+		configErr.locate(e.Data[idx].node)
+		return nil, configErr
+	}
+	e.resolving = append(e.resolving, idx)
+	resolved, err := e.Data[idx].resolve(e)
+	e.resolving = e.resolving[:len(e.resolving)-1]
+	if err != nil {
 		return nil, err
 	}
-	return opt, nil
+	if e.resolved == nil {
+		e.resolved = make(map[int]Installable)
+	}
+	e.resolved[idx] = resolved
+	return resolved, nil
 }
 
-func fromUntypedOption[T option](i interface{}, typed *T) error {
-	b, err := yaml.Marshal(i)
-	if err != nil {
-		return err
+// find returns the index of the last entry of name at version, or of name when version is empty.
+// resolveDep resolves dep, the name of an entry, or of a version of it, e.g. buf@v1.26.1.
+func (e *entries) resolveDep(dep string) (Installable, error) {
+	name, version, _ := strings.Cut(dep, "@")
+	return e.resolveVersion(name, version)
+}
+
+func (e *entries) find(name, version string) (int, bool) {
+	for idx := len(e.Data) - 1; idx >= 0; idx-- {
+		if e.Data[idx].Name == name && (version == "" || e.Data[idx].Version == version) {
+			return idx, true
+		}
 	}
-	return yaml.Unmarshal(b, typed)
+	return -1, false
 }
 
-func versioned(e entry) string {
-	return e.Name + "@" + e.Version
+func typedOption[T any](e Entry) (*T, error) {
+	opt := new(T)
+	if err := e.DecodeOption(opt); err != nil {
+		return nil, err
+	}
+	return opt, nil
 }
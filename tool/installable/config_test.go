@@ -1,6 +1,7 @@
 package installable
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -8,7 +9,7 @@ import (
 
 func TestResolveEntry(t *testing.T) {
 	{
-		e := &entry{
+		e := &Entry{
 			Name:    "some",
 			Type:    "some:binary",
 			Version: "v1.31.0",
@@ -21,7 +22,7 @@ func TestResolveEntry(t *testing.T) {
 	}
 
 	{
-		e := &entry{
+		e := &Entry{
 			Name:    "protoc-gen-go",
 			Type:    goBinaryType,
 			Version: "v1.31.0",
@@ -36,7 +37,7 @@ func TestResolveEntry(t *testing.T) {
 	}
 
 	{
-		e := &entry{
+		e := &Entry{
 			Name:    "helm",
 			Type:    httpArchiveType,
 			Version: "v3.12.3",
@@ -51,7 +52,7 @@ func TestResolveEntry(t *testing.T) {
 	}
 
 	{
-		e := &entry{
+		e := &Entry{
 			Name:    "protoc-gen-connect-es",
 			Type:    npmBinaryType,
 			Version: "v0.13.0",
@@ -62,7 +63,7 @@ func TestResolveEntry(t *testing.T) {
 		}
 
 		all := &entries{
-			Data: []entry{
+			Data: []Entry{
 				{
 					Name: "node",
 					Type: httpArchiveType,
@@ -77,3 +78,136 @@ func TestResolveEntry(t *testing.T) {
 		require.NotNil(t, bin.runtime)
 	}
 }
+
+type customBinary struct {
+	entry   Entry
+	option  customBinaryOption
+	runtime Installable
+}
+
+type customBinaryOption struct {
+	Runtime string `yaml:"runtime"`
+	Tap     string `yaml:"tap"`
+}
+
+func (c *customBinary) Install(context.Context, string, Options) (string, error) {
+	return "", nil
+}
+
+func (c *customBinary) Runtime() Installable {
+	return c.runtime
+}
+
+func TestRegister(t *testing.T) {
+	Register("test:custom", func(e Entry) (Installable, error) {
+		c := &customBinary{entry: e}
+		if err := e.DecodeOption(&c.option); err != nil {
+			return nil, err
+		}
+		if c.option.Runtime != "" {
+			runtime, err := e.Resolve(c.option.Runtime)
+			if err != nil {
+				return nil, err
+			}
+			c.runtime = runtime
+		}
+		return c, nil
+	})
+	t.Cleanup(func() { unregister("test:custom") })
+	require.Contains(t, Types(), "test:custom")
+	require.Panics(t, func() {
+		Register(goBinaryType, newGoBinary)
+	})
+
+	installables, err := Load([]byte(`tools:
+  - name: node
+    type: http:archive
+    version: v20.5.1
+    source: 'https://nodejs.org/dist/{{ .Version }}/node-{{ .Version }}-{{ .OS }}-{{ .Arch }}{{ .Ext }}'
+  - name: formula
+    type: test:custom
+    version: v1.0.0
+    source: example/formula
+    option:
+      runtime: node
+      tap: example/tap
+`))
+	require.NoError(t, err)
+	custom, ok := installables["formula"].(*customBinary)
+	require.True(t, ok)
+	require.Equal(t, "example/tap", custom.option.Tap)
+	require.Equal(t, "formula@v1.0.0", custom.entry.Versioned())
+	require.Same(t, installables["node"], custom.Runtime())
+
+	_, err = Load([]byte(`tools:
+  - name: unknown
+    type: test:unknown
+`))
+	require.ErrorIs(t, err, ErrEntryInvalid)
+}
+
+func TestVersions(t *testing.T) {
+	installables, err := LoadGraph([]byte(`tools:
+  - name: buf
+    type: go:binary
+    version: v1.26.1
+    source: github.com/bufbuild/buf/cmd/buf
+  - name: buf
+    type: go:binary
+    version: v1.29.0
+    source: github.com/bufbuild/buf/cmd/buf
+`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"buf"}, installables.Names())
+	require.Equal(t, []string{"buf@v1.26.1", "buf@v1.29.0"}, installables.Versions())
+
+	// The last entry is the default.
+	info, err := installables.ResolveInfo("buf")
+	require.NoError(t, err)
+	require.Equal(t, "buf@v1.29.0", installables.Versioned(info.Installers[0]))
+	require.True(t, installables.IsDefault(info.Installers[0]))
+
+	info, err = installables.ResolveInfo("buf@v1.26.1")
+	require.NoError(t, err)
+	require.Equal(t, "buf", info.Binary)
+	require.Equal(t, "buf@v1.26.1", installables.Versioned(info.Installers[0]))
+	require.False(t, installables.IsDefault(info.Installers[0]))
+	require.Equal(t, "buf", installables.Name(info.Installers[0]))
+
+	_, err = installables.ResolveInfo("buf@v1.0.0")
+	require.ErrorIs(t, err, ErrEntryInvalid)
+}
+
+func TestConfigError(t *testing.T) {
+	_, err := Load([]byte(`verify: maybe
+tools:
+  - name: kind
+    type: http:binray
+    version: v0.20.0
+    source: https://kind.sigs.k8s.io/dl/{{ .Version }}/kind-{{ .OS }}-{{ .Arch }}
+  - name: helm
+    type: http:archive
+    version: v3.12.3
+    source: https://get.helm.sh/helm-{{ .Version }}-{{ .OS }}-{{ .Arch }}{{ .Ext }}
+    option:
+      shas: none
+  - name: kubectl
+    type: http:binary
+    version: v1.28.1
+    source: https://dl.k8s.io/release/{{ .Version }}/bin/{{ .OS }}/{{ .Arch }}/kubectl
+    option:
+      verify: never
+    deps:
+      - helm
+      - kinds
+`))
+	require.ErrorIs(t, err, ErrEntryInvalid)
+	var configErr *ConfigError
+	require.ErrorAs(t, err, &configErr)
+	require.Equal(t, 1, configErr.Line)
+	require.Equal(t, `line 1, column 9: unknown verify policy "maybe", expecting required, warn or tofu
+line 4, column 11: kind: type: unknown type "http:binray", did you mean "http:binary"?
+line 12: helm: option: cannot unmarshal !!str `+"`none`"+` into map[string]string
+line 18, column 15: kubectl: option.verify: unknown verify policy "never", expecting required, warn or tofu
+line 21, column 9: kubectl: deps: unknown dependency "kinds", did you mean "kind"?`, err.Error())
+}
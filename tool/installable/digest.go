@@ -0,0 +1,81 @@
+package installable
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// digestAlgorithms are the supported algorithms of digests, e.g. in shas.
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// digest is a parsed digest, either "<algorithm>:<hex>", e.g. sha512:<hex>, or the Subresource
+// Integrity "<algorithm>-<base64>" as used by npm.
+type digest struct {
+	algorithm string
+	sum       []byte
+	sri       bool
+}
+
+func parseDigest(value string) (digest, error) {
+	var (
+		d       digest
+		encoded string
+		ok      bool
+	)
+	if d.algorithm, encoded, ok = strings.Cut(value, ":"); !ok {
+		if d.algorithm, encoded, ok = strings.Cut(value, "-"); !ok {
+			return d, fmt.Errorf("malformed digest %q: %w", value, ErrEntryInvalid)
+		}
+		d.sri = true
+	}
+	newHash, ok := digestAlgorithms[d.algorithm]
+	if !ok {
+		return d, fmt.Errorf("unknown digest algorithm %q of %q, expecting sha256, sha384 or sha512: %w", d.algorithm, value, ErrEntryInvalid)
+	}
+	var err error
+	if d.sri {
+		d.sum, err = base64.StdEncoding.DecodeString(encoded)
+	} else {
+		d.sum, err = hex.DecodeString(encoded)
+	}
+	if err != nil || len(d.sum) != newHash().Size() {
+		return d, fmt.Errorf("malformed %s digest %q: %w", d.algorithm, value, ErrEntryInvalid)
+	}
+	return d, nil
+}
+
+// String returns the digest as "<algorithm>:<hex>".
+func (d digest) String() string {
+	return d.algorithm + ":" + hex.EncodeToString(d.sum)
+}
+
+// format returns the digest the way it was written, either "<algorithm>:<hex>" or
+// "<algorithm>-<base64>".
+func (d digest) format() string {
+	if d.sri {
+		return d.algorithm + "-" + base64.StdEncoding.EncodeToString(d.sum)
+	}
+	return d.String()
+}
+
+// digestFile returns the digest of file with algorithm.
+func digestFile(algorithm, file string) (digest, error) {
+	newHash, ok := digestAlgorithms[algorithm]
+	if !ok {
+		return digest{}, fmt.Errorf("unknown digest algorithm %q: %w", algorithm, ErrEntryInvalid)
+	}
+	h := newHash()
+	if err := hashFile(h, file); err != nil {
+		return digest{}, err
+	}
+	return digest{algorithm: algorithm, sum: h.Sum(nil)}, nil
+}
@@ -0,0 +1,76 @@
+package installable
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDigest(t *testing.T) {
+	sum := sha512.Sum384([]byte("kind"))
+	tests := []struct {
+		value string
+		want  string
+		err   string
+	}{
+		{"sha384:" + hex.EncodeToString(sum[:]), "sha384:" + hex.EncodeToString(sum[:]), ""},
+		{"sha384-" + base64.StdEncoding.EncodeToString(sum[:]), "sha384:" + hex.EncodeToString(sum[:]), ""},
+		{"md5:" + hex.EncodeToString(sum[:16]), "", `unknown digest algorithm "md5"`},
+		{"sha512:" + hex.EncodeToString(sum[:]), "", "malformed sha512 digest"},
+		{hex.EncodeToString(sum[:]), "", "malformed digest"},
+	}
+	for _, test := range tests {
+		got, err := parseDigest(test.value)
+		if test.err != "" {
+			require.ErrorIs(t, err, ErrEntryInvalid, test.value)
+			require.ErrorContains(t, err, test.err, test.value)
+			continue
+		}
+		require.NoError(t, err, test.value)
+		require.Equal(t, test.want, got.String(), test.value)
+	}
+}
+
+func TestSHA512(t *testing.T) {
+	content := []byte("#!/bin/sh\necho kind\n")
+	sum := sha512.Sum512(content)
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	cache := NewCache(t.TempDir())
+	bin := &httpBinary{
+		name:      "kind",
+		version:   "v0.20.0",
+		versioned: "kind@v0.20.0",
+		source:    srv.URL + "/{{ .Version }}/kind",
+		option:    httpBinaryOption{SHAs: map[string]string{hostPlatform: "sha512-" + base64.StdEncoding.EncodeToString(sum[:])}},
+	}
+	installed, err := bin.Install(context.Background(), t.TempDir(), Options{Cache: cache})
+	require.NoError(t, err)
+	data, err := os.ReadFile(path.Join(installed, "kind"))
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+
+	// The cached artifact is found by its sha512 digest too.
+	_, err = bin.Install(context.Background(), t.TempDir(), Options{Cache: cache, Offline: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, requests)
+
+	sum[0]++
+	bin.option.SHAs[hostPlatform] = "sha512:" + hex.EncodeToString(sum[:])
+	_, err = bin.Install(context.Background(), t.TempDir(), Options{})
+	require.ErrorIs(t, err, ErrEntryInvalid)
+}
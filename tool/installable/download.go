@@ -0,0 +1,255 @@
+package installable
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Fetch returns the artifact of url and its sha256 digest, verified against want, e.g.
+// "sha256:<hex>" or "sha512-<base64>", from opts.Cache when it has it, or downloaded to dst
+// otherwise unless opts.Offline. An empty want, as allowed by a VerifyPolicy, downloads the
+// artifact unverified. Callers call the returned func when done with the file.
+func Fetch(ctx context.Context, dst, url, versioned, want string, opts Options) (string, string, func(), error) {
+	if opts.Cache != nil && want != "" {
+		if blob, release, ok := opts.Cache.get(want); ok {
+			return blob, blobDigest(blob), release, nil
+		}
+	}
+	if opts.Offline {
+		return "", "", nil, &MissingArtifactError{Tool: versioned, Platform: hostPlatform, Source: url}
+	}
+
+	downloaded, digest, err := download(ctx, dst, url, versioned, opts.retryPolicy())
+	if err != nil {
+		return "", "", nil, err
+	}
+	release := func() {
+		_ = os.Remove(downloaded)
+	}
+	if err = checksum(versioned, want, downloaded, digest); err != nil {
+		release()
+		return "", "", nil, err
+	}
+	if opts.Cache != nil {
+		if err = opts.Cache.put(digest, downloaded, want); err != nil {
+			release()
+			return "", "", nil, err
+		}
+	}
+	return downloaded, digest, release, nil
+}
+
+// RetryPolicy controls how failed downloads are retried.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, including the first one.
+	Attempts int
+	// Backoff is the delay before the first retry, doubled for each following retry.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between retries.
+	MaxBackoff time.Duration
+	// RetryableStatusCodes lists the HTTP status codes worth retrying. Network errors, e.g. a
+	// dropped connection, are always retried.
+	RetryableStatusCodes []int
+}
+
+// DefaultRetryPolicy is used when Options.Retry is not set.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   5,
+	Backoff:    time.Second,
+	MaxBackoff: 30 * time.Second,
+	RetryableStatusCodes: []int{
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return backoff
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return slices.Contains(p.RetryableStatusCodes, statusErr.code)
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+type statusError struct {
+	url  string
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code while reading %s: %v", e.url, e.code)
+}
+
+// download streams url to a temporary file in dst, hashing it on the fly, and returns the file
+// with its digest, e.g. "sha256:<hex>". Failed attempts are retried following policy, resuming
+// from where the previous attempt stopped when the server supports range requests. Callers
+// remove the file.
+func download(ctx context.Context, dst, url, name string, policy RetryPolicy) (string, string, error) {
+	downloadsDir := path.Join(dst, ".downloads")
+	if err := os.MkdirAll(downloadsDir, os.ModePerm); err != nil {
+		return "", "", err
+	}
+	removeLeftovers(downloadsDir, name)
+
+	f, err := os.CreateTemp(downloadsDir, name+"-")
+	if err != nil {
+		return "", "", err
+	}
+	d := &downloader{url: url, file: f, hash: sha256.New(), counter: &writeCounter{name: name}}
+	for attempt := 1; ; attempt++ {
+		err = d.fetch(ctx)
+		if err == nil || attempt >= policy.Attempts || !policy.retryable(err) {
+			break
+		}
+		if err = sleep(ctx, policy.backoff(attempt)); err != nil {
+			break
+		}
+	}
+	output.done(name)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", "", err
+	}
+	return f.Name(), "sha256:" + hex.EncodeToString(d.hash.Sum(nil)), nil
+}
+
+// downloader keeps what was downloaded across attempts.
+type downloader struct {
+	url     string
+	file    *os.File
+	hash    hash.Hash
+	counter *writeCounter
+
+	written int64
+	ranges  bool
+}
+
+func (d *downloader) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", d.url, nil)
+	if err != nil {
+		return err
+	}
+	resume := d.written > 0 && d.ranges
+	if resume {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", d.written))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch {
+	case resume && resp.StatusCode == http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", d.written)) {
+			return d.restart(fmt.Errorf("unexpected content range while resuming %s, restarting", d.url))
+		}
+	case resp.StatusCode == http.StatusOK:
+		if err = d.restart(nil); err != nil {
+			return err
+		}
+		d.ranges = resp.Header.Get("Accept-Ranges") == "bytes"
+	case resume && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		return d.restart(fmt.Errorf("cannot resume %s, restarting", d.url))
+	default:
+		return &statusError{url: d.url, code: resp.StatusCode}
+	}
+
+	n, err := io.Copy(io.MultiWriter(d.file, d.hash), io.TeeReader(resp.Body, d.counter))
+	d.written += n
+	return err
+}
+
+// restart drops what was downloaded so far, and returns err.
+func (d *downloader) restart(err error) error {
+	d.written = 0
+	d.ranges = false
+	d.hash.Reset()
+	d.counter.total = 0
+	if _, seekErr := d.file.Seek(0, io.SeekStart); seekErr != nil {
+		return seekErr
+	}
+	if truncateErr := d.file.Truncate(0); truncateErr != nil {
+		return truncateErr
+	}
+	return err
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// checksum verifies file, whose sha256 digest is sha, against want. want may use another algorithm,
+// e.g. sha512:<hex> or sha512-<base64>, or be empty for an unverified file.
+func checksum(name, want, file, sha string) error {
+	if want == "" {
+		return nil
+	}
+	expected, err := parseDigest(want)
+	if err != nil {
+		return fmt.Errorf("failed to checksum %s: %w", name, err)
+	}
+	got := sha
+	if expected.algorithm != "sha256" {
+		computed, err := digestFile(expected.algorithm, file)
+		if err != nil {
+			return err
+		}
+		got = computed.String()
+	}
+	if got != expected.String() {
+		return fmt.Errorf("failed to checksum %q: %s vs. %s %w", name, got, expected, ErrEntryInvalid)
+	}
+	return nil
+}
+
+type writeCounter struct {
+	name  string
+	total uint64
+}
+
+func (wc *writeCounter) Write(p []byte) (int, error) {
+	n := len(p)
+	wc.total += uint64(n)
+	output.progress(wc.name, wc.total)
+	return n, nil
+}
@@ -0,0 +1,139 @@
+package installable
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownload(t *testing.T) {
+	content := []byte("#!/bin/sh\necho kubectl\n")
+	sum := sha256.Sum256(content)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1.28.1/kubectl" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	dst := t.TempDir()
+	downloaded, got, err := download(context.Background(), dst, srv.URL+"/v1.28.1/kubectl", "kubectl@v1.28.1", DefaultRetryPolicy)
+	require.NoError(t, err)
+	require.Equal(t, digest, got)
+	data, err := os.ReadFile(downloaded)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+
+	_, _, err = download(context.Background(), dst, srv.URL+"/v1.28.2/kubectl", "kubectl@v1.28.2", DefaultRetryPolicy)
+	require.Error(t, err)
+
+	bin := &httpBinary{
+		name:      "kubectl",
+		version:   "v1.28.1",
+		versioned: "kubectl@v1.28.1",
+		source:    srv.URL + "/{{ .Version }}/kubectl",
+		option:    httpBinaryOption{SHAs: map[string]string{hostPlatform: digest}},
+	}
+	lock, err := LoadLock(nil)
+	require.NoError(t, err)
+	installed, err := bin.Install(context.Background(), dst, Options{Lock: lock})
+	require.NoError(t, err)
+	require.FileExists(t, path.Join(installed, "kubectl"))
+	require.Equal(t, LockedArtifact{
+		URL:    srv.URL + "/v1.28.1/kubectl",
+		Digest: digest,
+		Files:  []string{"kubectl"},
+	}, lock.Tools["kubectl"].Artifacts[hostPlatform])
+
+	// The downloaded file was moved into place, and the earlier download was a leftover.
+	leftovers, err := os.ReadDir(path.Join(dst, ".downloads"))
+	require.NoError(t, err)
+	require.Empty(t, leftovers)
+}
+
+func TestDownloadRetry(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10*1024)
+	sum := sha256.Sum256(content)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	policy := RetryPolicy{Attempts: 3, Backoff: time.Millisecond, RetryableStatusCodes: []int{http.StatusServiceUnavailable}}
+
+	var (
+		requests int
+		ranges   []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		ranges = append(ranges, r.Header.Get("Range"))
+		switch r.URL.Path {
+		case "/unavailable":
+			if requests == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/drop":
+			if requests == 1 {
+				// Send half of the content, then drop the connection.
+				w.Header().Set("Accept-Ranges", "bytes")
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(content[:len(content)/2])
+				w.(http.Flusher).Flush()
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					// Not FailNow, outside of the test goroutine.
+					t.Error(err)
+					return
+				}
+				_ = conn.Close()
+				return
+			}
+		case "/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	for _, test := range []struct {
+		path     string
+		requests int
+		ranges   []string
+		err      bool
+	}{
+		{path: "/unavailable", requests: 2, ranges: []string{"", ""}},
+		{path: "/drop", requests: 2, ranges: []string{"", fmt.Sprintf("bytes=%d-", len(content)/2)}},
+		{path: "/forbidden", requests: 1, ranges: []string{""}, err: true},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			requests, ranges = 0, nil
+			downloaded, got, err := download(context.Background(), t.TempDir(), srv.URL+test.path, "ko@v0.14.1", policy)
+			require.Equal(t, test.requests, requests)
+			require.Equal(t, test.ranges, ranges)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, digest, got)
+			data, err := os.ReadFile(downloaded)
+			require.NoError(t, err)
+			require.Equal(t, content, data)
+		})
+	}
+}
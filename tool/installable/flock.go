@@ -0,0 +1,53 @@
+package installable
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/dio/magex/tool/internal/flock"
+)
+
+// ErrToolLocked notifies that a tool is locked by another process.
+var ErrToolLocked = errors.New("tool is locked by another process")
+
+// LockTool locks name in dst exclusively, while installing, upgrading or removing any of its
+// versions. It waits for other processes holding the lock up to timeout.
+func LockTool(ctx context.Context, dst, name string, timeout time.Duration) (func(), error) {
+	unlock, err := flock.Lock(ctx, path.Join(dst, ".locks", name+".lock"), true, timeout)
+	if errors.Is(err, flock.ErrLocked) {
+		return nil, fmt.Errorf("%s: gave up after waiting %s for another process to install it: %w", name, timeout, ErrToolLocked)
+	}
+	return unlock, err
+}
+
+// UseTool locks an installed version, e.g. buf@v1.26.1, in dst as shared, so other processes do
+// not remove it while it is in use. It waits for other processes removing it up to timeout.
+func UseTool(ctx context.Context, dst, versioned string, timeout time.Duration) (func(), error) {
+	unlock, err := flock.Lock(ctx, versionLockFile(dst, versioned), false, timeout)
+	if errors.Is(err, flock.ErrLocked) {
+		return nil, fmt.Errorf("%s: gave up after waiting %s for another process to remove it: %w", versioned, timeout, ErrToolLocked)
+	}
+	return unlock, err
+}
+
+// RemoveUnused removes an installed version, e.g. buf@v1.26.1, from dst unless another process
+// uses it. It returns true when removed.
+func RemoveUnused(dst, versioned string) (bool, error) {
+	unlock, err := flock.TryLock(versionLockFile(dst, versioned), true)
+	if err != nil {
+		if errors.Is(err, flock.ErrLocked) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer unlock()
+	return true, os.RemoveAll(path.Join(dst, versioned))
+}
+
+func versionLockFile(dst, versioned string) string {
+	return path.Join(dst, ".locks", versioned+".lock")
+}
@@ -2,9 +2,11 @@ package installable
 
 import (
 	"context"
+	"debug/buildinfo"
 	"errors"
-	"fmt"
+	"os"
 	"path"
+	"strings"
 
 	"github.com/magefile/mage/sh"
 )
@@ -12,6 +14,7 @@ import (
 var goBinaryType = "go:binary"
 
 type goBinaryOption struct {
+	// CI set to skip skips the tool on CI, as when: !ci does.
 	CI string `yaml:"ci"`
 }
 
@@ -23,23 +26,131 @@ type goBinary struct {
 	option    goBinaryOption
 }
 
-func (a *goBinary) Install(_ context.Context, dst string) (string, error) {
+func newGoBinary(e Entry) (Installable, error) {
+	opt, err := typedOption[goBinaryOption](e)
+	if err != nil {
+		return nil, err
+	}
+	return &goBinary{
+		name:      e.Name,
+		source:    e.Source,
+		version:   e.Version,
+		versioned: e.Versioned(),
+		option:    *opt,
+	}, nil
+}
+
+func (a *goBinary) Install(_ context.Context, dst string, opts Options) (string, error) {
 	installed := path.Join(dst, a.versioned)
-	if err := checkInstalled(dst, a.name, a.versioned, a.option.CI); err != nil {
+	if err := opts.Lock.Check(opts.lockName(a.name), a.locked()); err != nil {
+		return "", err
+	}
+	if err := checkInstalled(dst, a.versioned); err != nil {
 		if errors.Is(err, ErrInstallableAlreadyInstalled) {
-			return installed, nil
+			return installed, a.lock(opts.Lock, opts.lockName(a.name), hostPlatform, installed)
 		}
 		return installed, err
 	}
-	fmt.Printf("Installing %s", a.versioned)
-	fmt.Println()
+	output.Printf("Installing %s", a.versioned)
 
+	return installed, stage(dst, a.versioned, func(staging string) error {
+		// Binaries built earlier, e.g. by another project, are reused from the cache.
+		key := a.treeKey(hostPlatform)
+		if tree, release, ok := opts.Cache.findTree(key); ok {
+			defer release()
+			if err := copyTree(tree, staging, opts.Cache.Link); err != nil {
+				return err
+			}
+			return a.lock(opts.Lock, opts.lockName(a.name), hostPlatform, staging)
+		}
+		if opts.Offline {
+			return &MissingArtifactError{Tool: a.versioned, Platform: hostPlatform, Source: a.source + "@" + a.version}
+		}
+
+		if err := a.build(staging, hostPlatform); err != nil {
+			return err
+		}
+		if err := a.lock(opts.Lock, opts.lockName(a.name), hostPlatform, staging); err != nil {
+			return err
+		}
+		return opts.Cache.putTree(key, staging)
+	})
+}
+
+func (a *goBinary) Vendor(_ context.Context, platform string, opts Options) ([]string, error) {
+	tree, rel, err := vendorTree(a.treeKey(platform), a.versioned, platform, a.source+"@"+a.version, func(dir string) error {
+		return a.build(dir, platform)
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []string{rel}, a.lock(opts.Lock, opts.lockName(a.name), platform, tree)
+}
+
+// build builds the binary for platform into dir.
+func (a *goBinary) build(dir, platform string) error {
+	if platform == hostPlatform {
+		env := map[string]string{
+			"GOBIN": dir,
+		}
+		return sh.RunWithV(env, "go", "install", a.source+"@"+a.version)
+	}
+
+	// The go command refuses to install cross-compiled binaries to GOBIN, hence they are installed
+	// to bin/os_arch of a scratch GOPATH, sharing the module cache.
+	modCache, err := sh.Output("go", "env", "GOMODCACHE")
+	if err != nil {
+		return err
+	}
+	scratch, err := os.MkdirTemp("", "magetools-gopath-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(scratch)
+	}()
+	goos, goarch, _ := strings.Cut(platform, "-")
 	env := map[string]string{
-		"GOBIN": installed,
+		"GOBIN":      "",
+		"GOPATH":     scratch,
+		"GOMODCACHE": modCache,
+		"GOOS":       goos,
+		"GOARCH":     goarch,
 	}
-	return installed, sh.RunWithV(env, "go", "install", a.source+"@"+a.version)
+	if err = sh.RunWithV(env, "go", "install", a.source+"@"+a.version); err != nil {
+		return err
+	}
+	return copyTree(path.Join(scratch, "bin", goos+"_"+goarch), dir, false)
+}
+
+func (a *goBinary) treeKey(platform string) string {
+	return goBinaryType + " " + a.source + "@" + a.version + " " + platform
 }
 
 func (a *goBinary) Runtime() Installable {
 	return nil
 }
+
+func (a *goBinary) locked() LockedTool {
+	return LockedTool{Version: a.version, Type: goBinaryType, Source: a.source}
+}
+
+// lock records the main module and its hash for platform, as embedded by the go command in the
+// binary.
+func (a *goBinary) lock(l *Lock, name, platform, installed string) error {
+	if l == nil {
+		return nil
+	}
+	files, err := installedFiles(installed)
+	if err != nil || len(files) == 0 {
+		return lockInstalledFor(l, name, platform, a.locked(), LockedArtifact{URL: a.source + "@" + a.version}, installed)
+	}
+	info, err := buildinfo.ReadFile(path.Join(installed, files[0]))
+	if err != nil {
+		return err
+	}
+	return lockInstalledFor(l, name, platform, a.locked(), LockedArtifact{
+		URL:    info.Main.Path + "@" + info.Main.Version,
+		Digest: info.Main.Sum,
+	}, installed)
+}
@@ -0,0 +1,88 @@
+package installable
+
+import (
+	"errors"
+	"slices"
+)
+
+// ErrDependencyCycle notifies installables depending on each other.
+var ErrDependencyCycle = errors.New("dependency cycle")
+
+func (g Graph) addDep(installable, dep Installable) {
+	for _, existing := range g.deps[installable] {
+		if existing == dep {
+			return
+		}
+	}
+	g.deps[installable] = append(g.deps[installable], dep)
+}
+
+// closure returns the dependencies of installable, transitively and each once, followed by
+// installable itself, so each comes after its dependencies.
+func (g Graph) closure(installable Installable) []Installable {
+	var (
+		ordered []Installable
+		visit   func(Installable)
+	)
+	visited := make(map[Installable]bool)
+	visit = func(current Installable) {
+		if visited[current] {
+			return
+		}
+		visited[current] = true
+		for _, dep := range g.deps[current] {
+			visit(dep)
+		}
+		ordered = append(ordered, current)
+	}
+	visit(installable)
+	return ordered
+}
+
+// cycle returns the installables of a cycle, the first one depending on the second one and so
+// on, and the last one on the first one, if an installable depends on itself, directly or not.
+func (g Graph) cycle() []Installable {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[Installable]int)
+	var (
+		path  []Installable
+		visit func(Installable) []Installable
+	)
+	visit = func(current Installable) []Installable {
+		switch state[current] {
+		case visited:
+			return nil
+		case visiting:
+			for idx := len(path) - 1; idx >= 0; idx-- {
+				if path[idx] == current {
+					return slices.Clone(path[idx:])
+				}
+			}
+		}
+		state[current] = visiting
+		path = append(path, current)
+		for _, dep := range g.deps[current] {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[current] = visited
+		return nil
+	}
+	for _, name := range g.Names() {
+		if cycle := visit(g.byName[name]); cycle != nil {
+			return cycle
+		}
+	}
+	for _, versioned := range g.Versions() {
+		if cycle := visit(g.versions[versioned]); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package installable
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeps(t *testing.T) {
+	{
+		installables, err := LoadGraph([]byte(`tools:
+  - name: node
+    type: http:archive
+    version: v20.5.1
+    source: 'https://nodejs.org/dist/{{ .Version }}/node-{{ .Version }}-{{ .OS }}-{{ .Arch }}{{ .Ext }}'
+  - name: buf
+    type: go:binary
+    version: v1.26.1
+    source: github.com/bufbuild/buf/cmd/buf
+  - name: protoc-gen-es
+    type: npm:binary
+    version: v1.3.0
+    source: '@bufbuild/protoc-gen-es'
+    deps: [buf, node]
+    option:
+      runtime: node
+  - name: generate
+    type: go:binary
+    version: v0.1.0
+    source: example.com/generate
+    deps: [protoc-gen-es]
+`))
+		require.NoError(t, err)
+
+		info, err := installables.ResolveInfo("generate")
+		require.NoError(t, err)
+		names := make([]string, 0, len(info.Installers))
+		for _, i := range info.Installers {
+			names = append(names, installables.Name(i))
+		}
+		// The runtime comes first, and node, shared as runtime and dep, only once.
+		require.Equal(t, []string{"node", "buf", "protoc-gen-es", "generate"}, names)
+
+		es, _ := installables.Get("protoc-gen-es")
+		require.Len(t, installables.Deps(es), 2)
+	}
+
+	{
+		_, err := Load([]byte(`tools:
+  - name: a
+    type: go:binary
+    version: v0.1.0
+    source: example.com/a
+    deps: [b]
+  - name: b
+    type: go:binary
+    version: v0.1.0
+    source: example.com/b
+    deps: [c]
+  - name: c
+    type: go:binary
+    version: v0.1.0
+    source: example.com/c
+    deps: [a]
+`))
+		require.ErrorIs(t, err, ErrDependencyCycle)
+		require.ErrorIs(t, err, ErrEntryInvalid)
+		require.EqualError(t, err, "line 6, column 12: a: deps: dependency cycle: a -> b -> c -> a")
+	}
+
+	{
+		// Reported along with other problems.
+		_, err := Load([]byte(`tools:
+  - name: a
+    type: go:binary
+    version: v0.1.0
+    source: example.com/a
+    deps: [b]
+  - name: b
+    type: go:binary
+    version: v0.1.0
+    source: example.com/b
+    deps: [a]
+  - name: c
+    type: go:binary
+    source: example.com/c
+`))
+		require.ErrorIs(t, err, ErrDependencyCycle)
+		require.EqualError(t, err, `line 12, column 5: c: version: is required
+line 6, column 12: a: deps: dependency cycle: a -> b -> a`)
+	}
+
+	{
+		// Runtimes are resolved along, so a runtime cycle fails while resolving.
+		_, err := Load([]byte(`tools:
+  - name: a
+    type: npm:binary
+    version: v0.1.0
+    source: a
+    option:
+      runtime: b
+  - name: b
+    type: npm:binary
+    version: v0.1.0
+    source: b
+    option:
+      runtime: a
+`))
+		require.ErrorIs(t, err, ErrDependencyCycle)
+		require.ErrorIs(t, err, ErrEntryInvalid)
+		require.ErrorContains(t, err, "line 2, column 5: a: dependency cycle: a -> b -> a")
+	}
+
+	{
+		_, err := Load([]byte(`tools:
+  - name: node
+    type: npm:binary
+    version: v0.1.0
+    source: node
+    option:
+      runtime: node
+`))
+		require.ErrorIs(t, err, ErrDependencyCycle)
+		require.EqualError(t, err, "line 2, column 5: node: dependency cycle: node -> node")
+	}
+
+	{
+		// A cycle through a runtime and deps.
+		_, err := Load([]byte(`tools:
+  - name: a
+    type: go:binary
+    version: v0.1.0
+    source: example.com/a
+    deps: [b]
+  - name: b
+    type: npm:binary
+    version: v0.1.0
+    source: b
+    option:
+      runtime: a
+`))
+		require.ErrorIs(t, err, ErrDependencyCycle)
+		require.ErrorContains(t, err, "a -> b -> a")
+	}
+
+	{
+		// A version other than the default, as a member of a group.
+		installables, err := LoadGraph([]byte(`tools:
+  - name: buf
+    type: go:binary
+    version: v1.26.1
+    source: github.com/bufbuild/buf/cmd/buf
+  - name: buf
+    type: go:binary
+    version: v1.29.0
+    source: github.com/bufbuild/buf/cmd/buf
+  - name: generate
+    type: go:binary
+    version: v0.1.0
+    source: example.com/generate
+    deps: [buf@v1.26.1]
+`))
+		require.NoError(t, err)
+		generate, _ := installables.Get("generate")
+		buf, _ := installables.Get("buf@v1.26.1")
+		require.Equal(t, []Installable{buf}, installables.Deps(generate))
+
+		_, err = Load([]byte(`tools:
+  - name: buf
+    type: go:binary
+    version: v1.26.1
+    source: github.com/bufbuild/buf/cmd/buf
+  - name: generate
+    type: go:binary
+    version: v0.1.0
+    source: example.com/generate
+    deps: [buf@v1.0.0]
+`))
+		require.ErrorIs(t, err, ErrEntryInvalid)
+		require.ErrorContains(t, err, `line 10, column 12: generate: deps: unknown dependency "buf@v1.0.0"`)
+	}
+
+	{
+		_, err := Load([]byte(`tools:
+  - name: a
+    type: go:binary
+    deps: [missing]
+`))
+		require.ErrorIs(t, err, ErrEntryInvalid)
+		require.ErrorContains(t, err, `unknown dependency "missing"`)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	installables, err := LoadGraph([]byte(`tools:
+  - name: node
+    type: http:archive
+    version: v20.5.1
+    source: 'https://nodejs.org/dist/{{ .Version }}/node-{{ .Version }}-{{ .OS }}-{{ .Arch }}{{ .Ext }}'
+  - name: buf
+    type: go:binary
+    version: v1.26.1
+    source: github.com/bufbuild/buf/cmd/buf
+    groups: [proto]
+  - name: buf
+    type: go:binary
+    version: v1.28.1
+    source: github.com/bufbuild/buf/cmd/buf
+    groups: [proto, ci]
+  - name: prettier
+    type: npm:binary
+    version: v3.0.3
+    source: prettier
+    groups: [frontend, ci]
+    option:
+      runtime: node
+`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"ci", "frontend", "proto"}, installables.Groups())
+
+	members, err := installables.Group("proto")
+	require.NoError(t, err)
+	require.Equal(t, []string{"buf@v1.26.1", "buf"}, members)
+	members, err = installables.Group("ci")
+	require.NoError(t, err)
+	require.Equal(t, []string{"buf", "prettier"}, members)
+
+	// The runtime of a member is installed along.
+	members, err = installables.Group("frontend")
+	require.NoError(t, err)
+	info, err := installables.ResolveInfo(members[0])
+	require.NoError(t, err)
+	require.Len(t, info.Installers, 2)
+	require.Equal(t, "node", installables.Name(info.Installers[0]))
+
+	_, err = installables.Group("protos")
+	require.ErrorIs(t, err, ErrEntryInvalid)
+	require.ErrorContains(t, err, `unknown group: protos, did you mean "proto"?`)
+}
@@ -4,41 +4,37 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
-	"fmt"
+	"errors"
 	"html/template"
-	"io"
-	"net/http"
 	"os"
 	"path"
-	"runtime"
 	"strings"
 
 	"github.com/codeclysm/extract/v3"
-	"github.com/dustin/go-humanize"
 )
 
-var runningOnCI = os.Getenv("CI") != ""
+var runningOnCI = onCI()
 var httpArchiveType = "http:archive"
 
 type httpArchiveOption struct {
 	StripPrefix string `yaml:"stripPrefix"`
 
-	Overrides struct {
-		// TODO(dio): Make it typed.
-		OS     map[string]string `yaml:"os"`
-		Arch   map[string]string `yaml:"arch"`
-		Ext    map[string]string `yaml:"ext"`
-		OSArch map[string]string `yaml:"osArch"`
-	} `yaml:"overrides"`
+	Overrides overrides `yaml:"overrides"`
 
 	// TODO(dio): Have a way to set main binary and put it in a "bin" directory.
 	// This is for the case when an archive doesn't have "bin" directory, or the
 	// main binary is not in the "bin" directory.
 
 	SHAs map[string]string `yaml:"shas"`
-
+	// ChecksumURL is the URL of a checksum file listing the digest of the artifact, e.g.
+	// checksums.txt or <artifact>.sha256, used for platforms without shas.
+	ChecksumURL string `yaml:"checksumURL"`
+	// Signature verifies the signature of the artifact, e.g. with minisign.
+	Signature signature `yaml:"signature"`
+	// Verify is how artifacts without a digest are installed, overriding the one of the file.
+	Verify VerifyPolicy `yaml:"verify"`
+
+	// CI set to skip skips the tool on CI, as when: !ci does.
 	CI string `yaml:"ci"`
 }
 
@@ -50,50 +46,159 @@ type httpArchive struct {
 	option    httpArchiveOption
 }
 
-func (a *httpArchive) Install(ctx context.Context, dst string) (string, error) {
+func newHTTPArchive(e Entry) (Installable, error) {
+	opt, err := typedOption[httpArchiveOption](e)
+	if err != nil {
+		return nil, err
+	}
+	if err = opt.Verify.validate(); err != nil {
+		return nil, &ConfigError{Field: "option.verify", Err: err}
+	}
+	if err = checkTemplates(map[string]string{
+		"source":               e.Source,
+		"option.stripPrefix":   opt.StripPrefix,
+		"option.checksumURL":   opt.ChecksumURL,
+		"option.signature.url": opt.Signature.URL,
+	}); err != nil {
+		return nil, err
+	}
+	return &httpArchive{
+		name:      e.Name,
+		source:    e.Source,
+		version:   e.Version,
+		versioned: e.Versioned(),
+		option:    *opt,
+	}, nil
+}
+
+func (a *httpArchive) Install(ctx context.Context, dst string, opts Options) (string, error) {
 	versionedDir := path.Join(dst, a.versioned)
 	installed := path.Join(versionedDir, "bin")
 
-	if err := checkInstalled(dst, a.name, a.versioned, a.option.CI); err != nil {
+	if err := opts.Lock.Check(opts.lockName(a.name), a.locked()); err != nil {
+		return "", err
+	}
+	source, err := a.Source(hostPlatform)
+	if err != nil {
+		return installed, err
+	}
+	artifact := LockedArtifact{URL: source, Digest: infer(a.option.SHAs, hostPlatform, "")}
+
+	if err := checkInstalled(dst, a.versioned); err != nil {
 		if err == ErrInstallableAlreadyInstalled {
-			return installed, nil
+			return installed, lockInstalled(opts.Lock, opts.lockName(a.name), a.locked(), artifact, installed)
 		}
 		return installed, err
 	}
 
-	source, err := a.expand(a.name+":url", a.source)
+	want, err := a.digest(ctx, hostPlatform, source, opts)
 	if err != nil {
 		return installed, err
 	}
-	data, _, err := readRemoteFile(ctx, source, a.versioned)
+	downloaded, digest, release, err := Fetch(ctx, dst, source, a.versioned, want, opts)
 	if err != nil {
 		return installed, err
 	}
-	fmt.Println()
+	defer release()
+	if err = a.verify(ctx, hostPlatform, want, downloaded, opts); err != nil {
+		return installed, err
+	}
 
-	if err = a.checksum(data); err != nil {
+	artifact.Digest = digest
+	if err = opts.Lock.Verify(opts.lockName(a.name), a.locked(), artifact); err != nil {
 		return installed, err
 	}
 
-	br := bufio.NewReader(bytes.NewBuffer(data))
-	prefix, err := a.expand(a.name+":stripPrefix", a.option.StripPrefix)
+	prefix, err := a.expand(a.name+":stripPrefix", a.option.StripPrefix, hostPlatform)
 	if err != nil {
 		return installed, err
 	}
 
-	if err = extract.Archive(ctx, br, versionedDir, func(s string) string {
-		return strings.TrimPrefix(s, prefix)
-	}); err != nil {
-		return installed, err
+	extractTo := func(dir string) error {
+		f, err := os.Open(downloaded)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		if err = extract.Archive(ctx, bufio.NewReader(f), dir, func(s string) string {
+			return strings.TrimPrefix(s, prefix)
+		}); err != nil {
+			return err
+		}
+		return ensureBinDir(dir)
 	}
 
-	return installed, ensureBinDir(versionedDir)
+	return installed, stage(dst, a.versioned, func(staging string) error {
+		if opts.Cache != nil && opts.Cache.Link {
+			tree, release, err := opts.Cache.tree(digest+" "+prefix, extractTo)
+			if err != nil {
+				return err
+			}
+			defer release()
+			if err = copyTree(tree, staging, true); err != nil {
+				return err
+			}
+		} else if err := extractTo(staging); err != nil {
+			return err
+		}
+		return lockInstalled(opts.Lock, opts.lockName(a.name), a.locked(), artifact, path.Join(staging, "bin"))
+	})
 }
 
 func (a *httpArchive) Runtime() Installable {
 	return nil
 }
 
+func (a *httpArchive) Vendor(ctx context.Context, platform string, opts Options) ([]string, error) {
+	source, err := a.Source(platform)
+	if err != nil {
+		return nil, err
+	}
+	want, err := a.digest(ctx, platform, source, opts)
+	if err != nil {
+		return nil, err
+	}
+	return vendorDownload(ctx, opts.lockName(a.name), a.versioned, platform, source, want, a.locked(), func(file string) error {
+		return a.verify(ctx, platform, want, file, opts)
+	}, opts)
+}
+
+// verify verifies the signature of file, the artifact for platform, when configured, and trusts
+// it when it has no digest want, depending on the verify policy.
+func (a *httpArchive) verify(ctx context.Context, platform, want, file string, opts Options) error {
+	url, err := a.expand(a.name+":signature", a.option.Signature.URL, platform)
+	if err != nil {
+		return err
+	}
+	if err = a.option.Signature.verify(ctx, a.versioned, url, file, opts); err != nil {
+		return err
+	}
+	return trust(a.versioned, platform, want, file, a.option.Verify.or(opts.Verify), opts)
+}
+
+// digest returns the digest the artifact of source for platform must have.
+func (a *httpArchive) digest(ctx context.Context, platform, source string, opts Options) (string, error) {
+	checksumURL, err := a.expand(a.name+":checksumURL", a.option.ChecksumURL, platform)
+	if err != nil {
+		return "", err
+	}
+	return digestFor(ctx, opts.lockName(a.name), a.versioned, platform, source, checksumURL, a.option.SHAs, a.locked(), a.option.Verify.or(opts.Verify), opts)
+}
+
+func (a *httpArchive) Source(platform string) (string, error) {
+	return a.expand(a.name+":url", a.source, platform)
+}
+
+func (a *httpArchive) Platforms() []string {
+	return sortedKeys(a.option.SHAs)
+}
+
+func (a *httpArchive) locked() LockedTool {
+	return LockedTool{Version: a.version, Type: httpArchiveType, Source: a.source}
+}
+
 func hasBinDir(dir string) (bool, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
@@ -107,29 +212,6 @@ func hasBinDir(dir string) (bool, error) {
 	return false, nil
 }
 
-func (a *httpArchive) checksum(data []byte) error {
-	// TODO(dio): Add checksum.
-	name := runtime.GOOS + "-" + runtime.GOARCH
-	value := infer(a.option.SHAs, name, "")
-	if value == "" {
-		return ErrEntryInvalid
-	}
-
-	parts := strings.SplitN(value, ":", 2)
-	if len(parts) != 2 {
-		return fmt.Errorf("failed to checksum %s: %w", a.name, ErrEntryInvalid)
-	}
-
-	h := sha256.New()
-	_, _ = h.Write(data)
-	sum := h.Sum(nil)
-	encoded := hex.EncodeToString(sum)
-	if encoded != parts[1] {
-		return fmt.Errorf("failed to checksum %q: %s vs. %s %w", a.name, encoded, parts[1], ErrEntryInvalid)
-	}
-	return nil
-}
-
 // newExpandTemplate creates a new named template with common custom functions.
 var newExpandTemplate = func(name string) *template.Template {
 	return template.New(name).Funcs(template.FuncMap{
@@ -143,18 +225,44 @@ var newExpandTemplate = func(name string) *template.Template {
 	})
 }
 
-func (a *httpArchive) expand(name, text string) (string, error) {
+func (a *httpArchive) expand(name, text, platform string) (string, error) {
+	return expand(name, text, a.version, platform, a.option.Overrides)
+}
+
+// overrides maps the values of template variables, e.g. {{ .Arch }} to x86_64 for amd64.
+type overrides struct {
+	// TODO(dio): Make it typed.
+	OS     map[string]string `yaml:"os"`
+	Arch   map[string]string `yaml:"arch"`
+	Ext    map[string]string `yaml:"ext"`
+	OSArch map[string]string `yaml:"osArch"`
+}
+
+// checkTemplates parses templates, keyed by their field, e.g. source.
+func checkTemplates(templates map[string]string) error {
+	var errs []error
+	for _, field := range sortedKeys(templates) {
+		if _, err := newExpandTemplate(field).Parse(templates[field]); err != nil {
+			errs = append(errs, &ConfigError{Field: field, Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// expand renders text for version on platform, e.g. linux-amd64.
+func expand(name, text, version, platform string, o overrides) (string, error) {
 	u, err := newExpandTemplate(name).Parse(text)
 	if err != nil {
 		return "", err
 	}
+	goos, goarch, _ := strings.Cut(platform, "-")
 	var rendered bytes.Buffer
 	if err = u.Execute(&rendered, map[string]string{
-		"Version": a.version,
-		"OS":      infer(a.option.Overrides.OS, runtime.GOOS, runtime.GOOS),
-		"Arch":    infer(a.option.Overrides.Arch, runtime.GOARCH, runtime.GOARCH),
-		"OSArch":  infer(a.option.Overrides.OSArch, runtime.GOOS+"-"+runtime.GOARCH, runtime.GOOS+"-"+runtime.GOARCH),
-		"Ext":     infer(a.option.Overrides.Ext, runtime.GOOS, ".tar.gz"), // We default to .tar.gz
+		"Version": version,
+		"OS":      infer(o.OS, goos, goos),
+		"Arch":    infer(o.Arch, goarch, goarch),
+		"OSArch":  infer(o.OSArch, platform, platform),
+		"Ext":     infer(o.Ext, goos, ".tar.gz"), // We default to .tar.gz
 	}); err != nil {
 		return "", err
 	}
@@ -170,35 +278,6 @@ func infer(m map[string]string, ref, fallback string) string {
 	return fallback
 }
 
-func readRemoteFile(ctx context.Context, url, name string) ([]byte, http.Header, error) {
-	var buf bytes.Buffer
-	out := bufio.NewWriter(&buf)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, resp.Header, fmt.Errorf("unexpected status code while reading %s: %v", url, resp.StatusCode)
-	}
-
-	_, err = io.Copy(out, io.TeeReader(resp.Body, &writeCounter{name: name}))
-	if err != nil {
-		return nil, resp.Header, err
-	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-
-	return buf.Bytes(), resp.Header, nil
-}
-
 func ensureBinDir(dir string) error {
 	hasBin, err := hasBinDir(dir)
 	if err != nil {
@@ -221,28 +300,3 @@ func ensureBinDir(dir string) error {
 
 	return nil
 }
-
-type writeCounter struct {
-	name  string
-	total uint64
-}
-
-func (wc *writeCounter) Write(p []byte) (int, error) {
-	n := len(p)
-	wc.total += uint64(n)
-	wc.printProgress()
-	return n, nil
-}
-
-func (wc writeCounter) printProgress() {
-	if runningOnCI {
-		return
-	}
-	// Clear the line by using a character return to go back to the start and remove
-	// the remaining characters by filling it with spaces
-	fmt.Fprintf(os.Stderr, "\r%s", strings.Repeat(" ", 35))
-
-	// Return again and print current status of download
-	// We use the humanize package to print the bytes in a meaningful way (e.g. 10 MB)
-	fmt.Fprintf(os.Stderr, "\rDownloading %s... %s ", wc.name, humanize.Bytes(wc.total))
-}
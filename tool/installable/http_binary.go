@@ -1,34 +1,30 @@
 package installable
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
-	"fmt"
 	"os"
 	"path"
-	"runtime"
-	"strings"
 )
 
 var httpBinaryType = "http:binary"
 
 type httpBinaryOption struct {
-	Overrides struct {
-		// TODO(dio): Make it typed.
-		OS     map[string]string `yaml:"os"`
-		OSArch map[string]string `yaml:"osArch"`
-		Arch   map[string]string `yaml:"arch"`
-		Ext    map[string]string `yaml:"ext"`
-	} `yaml:"overrides"`
+	Overrides overrides `yaml:"overrides"`
 
 	// TODO(dio): Have a way to set main binary and put it in a "bin" directory.
 	// This is for the case when an archive doesn't have "bin" directory, or the
 	// main binary is not in the "bin" directory.
 
 	SHAs map[string]string `yaml:"shas"`
-
+	// ChecksumURL is the URL of a checksum file listing the digest of the artifact, e.g.
+	// checksums.txt or <artifact>.sha256, used for platforms without shas.
+	ChecksumURL string `yaml:"checksumURL"`
+	// Signature verifies the signature of the artifact, e.g. with minisign.
+	Signature signature `yaml:"signature"`
+	// Verify is how artifacts without a digest are installed, overriding the one of the file.
+	Verify VerifyPolicy `yaml:"verify"`
+
+	// CI set to skip skips the tool on CI, as when: !ci does.
 	CI string `yaml:"ci"`
 }
 
@@ -40,82 +36,150 @@ type httpBinary struct {
 	option    httpBinaryOption
 }
 
-func (a *httpBinary) Install(ctx context.Context, dst string) (string, error) {
+func newHTTPBinary(e Entry) (Installable, error) {
+	opt, err := typedOption[httpBinaryOption](e)
+	if err != nil {
+		return nil, err
+	}
+	if err = opt.Verify.validate(); err != nil {
+		return nil, &ConfigError{Field: "option.verify", Err: err}
+	}
+	if err = checkTemplates(map[string]string{
+		"source":               e.Source,
+		"option.checksumURL":   opt.ChecksumURL,
+		"option.signature.url": opt.Signature.URL,
+	}); err != nil {
+		return nil, err
+	}
+	return &httpBinary{
+		name:      e.Name,
+		source:    e.Source,
+		version:   e.Version,
+		versioned: e.Versioned(),
+		option:    *opt,
+	}, nil
+}
+
+func (a *httpBinary) Install(ctx context.Context, dst string, opts Options) (string, error) {
 	versionedDir := path.Join(dst, a.versioned)
 	installed := path.Join(versionedDir, "bin")
 
-	if err := checkInstalled(dst, a.name, a.versioned, a.option.CI); err != nil {
+	if err := opts.Lock.Check(opts.lockName(a.name), a.locked()); err != nil {
+		return "", err
+	}
+	source, err := a.Source(hostPlatform)
+	if err != nil {
+		return installed, err
+	}
+	artifact := LockedArtifact{URL: source, Digest: infer(a.option.SHAs, hostPlatform, "")}
+
+	if err := checkInstalled(dst, a.versioned); err != nil {
 		if err == ErrInstallableAlreadyInstalled {
-			return installed, nil
+			return installed, lockInstalled(opts.Lock, opts.lockName(a.name), a.locked(), artifact, installed)
 		}
 		return installed, err
 	}
 
-	source, err := a.expand(a.name+":url", a.source)
+	want, err := a.digest(ctx, hostPlatform, source, opts)
 	if err != nil {
 		return installed, err
 	}
-	data, _, err := readRemoteFile(ctx, source, a.versioned)
+	downloaded, digest, release, err := Fetch(ctx, dst, source, a.versioned, want, opts)
 	if err != nil {
 		return installed, err
 	}
-	fmt.Println()
-
-	if err := a.checksum(data); err != nil {
+	defer release()
+	if err = a.verify(ctx, hostPlatform, want, downloaded, opts); err != nil {
 		return installed, err
 	}
 
-	if err := os.MkdirAll(installed, os.ModePerm); err != nil {
+	artifact.Digest = digest
+	if err := opts.Lock.Verify(opts.lockName(a.name), a.locked(), artifact); err != nil {
 		return installed, err
 	}
 
-	if err := os.WriteFile(path.Join(installed, a.name), data, 0o777); err != nil {
-		return installed, err
-	}
+	return installed, stage(dst, a.versioned, func(staging string) error {
+		bin := path.Join(staging, "bin")
+		if err := os.MkdirAll(bin, os.ModePerm); err != nil {
+			return err
+		}
+		if err := placeBinary(downloaded, path.Join(bin, a.name), opts.Cache); err != nil {
+			return err
+		}
+		if err := ensureBinDir(staging); err != nil {
+			return err
+		}
+		return lockInstalled(opts.Lock, opts.lockName(a.name), a.locked(), artifact, bin)
+	})
+}
 
-	return installed, ensureBinDir(versionedDir)
+// placeBinary places the downloaded binary at dst, executable. It is linked to the cached artifact
+// with Link, unless the artifact has another mode, e.g. cached before blobMode: a linked file is
+// shared with the cache and other projects, so its mode is never changed.
+func placeBinary(downloaded, dst string, cache *Cache) error {
+	if cache != nil && cache.Link {
+		if info, err := os.Stat(downloaded); err == nil && info.Mode().Perm() == blobMode {
+			return linkOrCopy(downloaded, dst)
+		}
+	}
+	if err := copyFile(downloaded, dst); err != nil {
+		return err
+	}
+	return os.Chmod(dst, 0o755)
 }
 
 func (a *httpBinary) Runtime() Installable {
 	return nil
 }
 
-func (a *httpBinary) checksum(data []byte) error {
-	// TODO(dio): Add checksum.
-	name := runtime.GOOS + "-" + runtime.GOARCH
-	value := infer(a.option.SHAs, name, "")
-	if value == "" {
-		return ErrEntryInvalid
+func (a *httpBinary) Vendor(ctx context.Context, platform string, opts Options) ([]string, error) {
+	source, err := a.Source(platform)
+	if err != nil {
+		return nil, err
 	}
-
-	parts := strings.SplitN(value, ":", 2)
-	if len(parts) != 2 {
-		return fmt.Errorf("failed to checksum %s: %w", a.name, ErrEntryInvalid)
+	want, err := a.digest(ctx, platform, source, opts)
+	if err != nil {
+		return nil, err
 	}
+	return vendorDownload(ctx, opts.lockName(a.name), a.versioned, platform, source, want, a.locked(), func(file string) error {
+		return a.verify(ctx, platform, want, file, opts)
+	}, opts)
+}
 
-	h := sha256.New()
-	_, _ = h.Write(data)
-	sum := h.Sum(nil)
-	if hex.EncodeToString(sum) != parts[1] {
-		return fmt.Errorf("failed to checksum %s: %w", a.name, ErrEntryInvalid)
+// verify verifies the signature of file, the artifact for platform, when configured, and trusts
+// it when it has no digest want, depending on the verify policy.
+func (a *httpBinary) verify(ctx context.Context, platform, want, file string, opts Options) error {
+	url, err := a.expand(a.name+":signature", a.option.Signature.URL, platform)
+	if err != nil {
+		return err
 	}
-	return nil
+	if err = a.option.Signature.verify(ctx, a.versioned, url, file, opts); err != nil {
+		return err
+	}
+	return trust(a.versioned, platform, want, file, a.option.Verify.or(opts.Verify), opts)
 }
 
-func (a *httpBinary) expand(name, text string) (string, error) {
-	u, err := newExpandTemplate(name).Parse(text)
+// digest returns the digest the artifact of source for platform must have.
+func (a *httpBinary) digest(ctx context.Context, platform, source string, opts Options) (string, error) {
+	checksumURL, err := a.expand(a.name+":checksumURL", a.option.ChecksumURL, platform)
 	if err != nil {
 		return "", err
 	}
-	var rendered bytes.Buffer
-	if err = u.Execute(&rendered, map[string]string{
-		"Version": a.version,
-		"OS":      infer(a.option.Overrides.OS, runtime.GOOS, runtime.GOOS),
-		"Arch":    infer(a.option.Overrides.Arch, runtime.GOARCH, runtime.GOARCH),
-		"OSArch":  infer(a.option.Overrides.OSArch, runtime.GOOS+"-"+runtime.GOARCH, runtime.GOOS+"-"+runtime.GOARCH),
-		"Ext":     infer(a.option.Overrides.Ext, runtime.GOOS, ".tar.gz"), // We default to .tar.gz
-	}); err != nil {
-		return "", err
-	}
-	return rendered.String(), nil
+	return digestFor(ctx, opts.lockName(a.name), a.versioned, platform, source, checksumURL, a.option.SHAs, a.locked(), a.option.Verify.or(opts.Verify), opts)
+}
+
+func (a *httpBinary) Source(platform string) (string, error) {
+	return a.expand(a.name+":url", a.source, platform)
+}
+
+func (a *httpBinary) Platforms() []string {
+	return sortedKeys(a.option.SHAs)
+}
+
+func (a *httpBinary) locked() LockedTool {
+	return LockedTool{Version: a.version, Type: httpBinaryType, Source: a.source}
+}
+
+func (a *httpBinary) expand(name, text, platform string) (string, error) {
+	return expand(name, text, a.version, platform, a.option.Overrides)
 }
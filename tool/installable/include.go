@@ -0,0 +1,222 @@
+package installable
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// include is a file included by a .magetools.yaml file, either a local path, relative to the
+// including file, or a remote URL pinned by its digest.
+type include struct {
+	Path string `yaml:"path"`
+	URL  string `yaml:"url"`
+	SHA  string `yaml:"sha"`
+}
+
+// UnmarshalYAML decodes an include, given as a path or as a mapping.
+func (i *include) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		i.Path = node.Value
+		return nil
+	}
+	type plain include
+	return node.Decode((*plain)(i))
+}
+
+// Merge returns data, a .magetools.yaml file in dir, merged with the files it includes, in order,
+// each of them merged with its own includes first. An entry of a later file overrides the entry of
+// the same name of the files before it: the fields it sets replace the ones of the included
+// entry, e.g. version, and so do the keys of its option, e.g. shas. Within a file, several
+// entries of a name are versions installed side by side. Remote files are fetched with opts, and
+// kept in opts.Cache. Data without includes is returned as is.
+func Merge(ctx context.Context, dir string, data []byte, opts Options) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || mappingValue(doc.Content[0], "include") == nil {
+		return data, nil
+	}
+	merged, err := mergeIncludes(ctx, dir, doc.Content[0], opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	overlay(merged, doc.Content[0], "")
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(merged); err != nil {
+		return nil, err
+	}
+	if err = encoder.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// mergeIncludes returns the files included by root, in dir, merged in order. seen lists the
+// including files, to detect cycles.
+func mergeIncludes(ctx context.Context, dir string, root *yaml.Node, opts Options, seen []string) (*yaml.Node, error) {
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	includes := mappingValue(root, "include")
+	if includes == nil {
+		return merged, nil
+	}
+	var decoded []include
+	if err := includes.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	for idx, inc := range decoded {
+		name, data, err := readInclude(ctx, dir, inc, opts)
+		if err != nil {
+			configErr := &ConfigError{Field: "include", Err: err}
+			configErr.locate(includes.Content[idx])
+			return nil, configErr
+		}
+		if slices.Contains(seen, name) {
+			return nil, fmt.Errorf("%s is included by itself: %w", name, ErrEntryInvalid)
+		}
+		var doc yaml.Node
+		if err = yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		includedDir := ""
+		if inc.URL == "" {
+			includedDir = filepath.Dir(name)
+		}
+		included, err := mergeIncludes(ctx, includedDir, doc.Content[0], opts, append(seen, name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		overlay(included, doc.Content[0], name)
+		overlay(merged, included, "")
+	}
+	return merged, nil
+}
+
+// readInclude returns the name and the content of inc, a file included from dir.
+func readInclude(ctx context.Context, dir string, inc include, opts Options) (string, []byte, error) {
+	switch {
+	case inc.Path != "" && inc.URL != "":
+		return "", nil, errors.New("either a path or a url, not both")
+	case inc.Path != "":
+		if dir == "" {
+			return "", nil, fmt.Errorf("%s is relative to a remote file", inc.Path)
+		}
+		name := inc.Path
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		data, err := os.ReadFile(name)
+		return name, data, err
+	case inc.URL != "":
+		if inc.SHA == "" {
+			return "", nil, fmt.Errorf("%s is not pinned by a sha", inc.URL)
+		}
+		tmp, err := os.MkdirTemp("", "magetools-include-")
+		if err != nil {
+			return "", nil, err
+		}
+		defer func() {
+			_ = os.RemoveAll(tmp)
+		}()
+		fetched, _, release, err := Fetch(ctx, tmp, inc.URL, "include-"+filepath.Base(inc.URL), inc.SHA, opts)
+		if err != nil {
+			return "", nil, err
+		}
+		defer release()
+		data, err := os.ReadFile(fetched)
+		return inc.URL, data, err
+	}
+	return "", nil, errors.New("a path or a url is required")
+}
+
+// overlay merges layer, a file named source, into merged. The entries of layer override the ones
+// of the same name already in merged, while the others are appended, noting their source.
+func overlay(merged, layer *yaml.Node, source string) {
+	tools := mappingValue(merged, "tools")
+	if tools == nil {
+		tools = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		setMappingValue(merged, "tools", tools)
+	}
+	// Entries of a name in the same layer are versions side by side: the first one overrides the
+	// previous entry of the name, the others are appended.
+	previous := len(tools.Content)
+	overrides := make(map[string]bool)
+	for idx := 0; idx+1 < len(layer.Content); idx += 2 {
+		key, value := layer.Content[idx], layer.Content[idx+1]
+		switch key.Value {
+		case "include":
+		case "tools":
+			for _, entry := range value.Content {
+				name := mappingValue(entry, "name")
+				if overridden := lastEntry(tools.Content[:previous], name); overridden != nil && !overrides[name.Value] {
+					overrides[name.Value] = true
+					overrideEntry(overridden, entry)
+					if overridden.HeadComment != "" {
+						overridden.HeadComment += ", overridden"
+						if source != "" {
+							overridden.HeadComment += " by " + source
+						}
+					}
+					continue
+				}
+				entry = copyNode(entry)
+				if source != "" && entry.HeadComment == "" {
+					entry.HeadComment = "# from " + source
+				}
+				tools.Content = append(tools.Content, entry)
+			}
+		default:
+			setMappingValue(merged, key.Value, value)
+		}
+	}
+}
+
+// lastEntry returns the last entry of name in entries.
+func lastEntry(entries []*yaml.Node, name *yaml.Node) *yaml.Node {
+	if name == nil {
+		return nil
+	}
+	for idx := len(entries) - 1; idx >= 0; idx-- {
+		if other := mappingValue(entries[idx], "name"); other != nil && other.Value == name.Value {
+			return entries[idx]
+		}
+	}
+	return nil
+}
+
+// overrideEntry sets the fields of entry, and the keys of its option, to the ones of override.
+func overrideEntry(entry, override *yaml.Node) {
+	for idx := 0; idx+1 < len(override.Content); idx += 2 {
+		key, value := override.Content[idx], override.Content[idx+1]
+		option := mappingValue(entry, "option")
+		if key.Value == "option" && option != nil && option.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+			option = copyNode(option)
+			for optionIdx := 0; optionIdx+1 < len(value.Content); optionIdx += 2 {
+				setMappingValue(option, value.Content[optionIdx].Value, value.Content[optionIdx+1])
+			}
+			setMappingValue(entry, "option", option)
+			continue
+		}
+		setMappingValue(entry, key.Value, value)
+	}
+}
+
+// copyNode returns a shallow copy of node, so changing its content leaves node as is.
+func copyNode(node *yaml.Node) *yaml.Node {
+	copied := *node
+	copied.Content = slices.Clone(node.Content)
+	return &copied
+}
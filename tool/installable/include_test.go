@@ -0,0 +1,138 @@
+package installable
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	remote := []byte(`tools:
+  - name: gosimports
+    type: go:binary
+    version: v0.3.5
+    source: github.com/rinchsan/gosimports/cmd/gosimports
+`)
+	sum := sha256.Sum256(remote)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/company.yaml" {
+			_, _ = w.Write(remote)
+			return
+		}
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "baseline"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "baseline", "tools.yaml"), []byte(`verify: warn
+include:
+  - url: `+srv.URL+`/company.yaml
+    sha: sha256:`+hex.EncodeToString(sum[:])+`
+tools:
+  - name: buf
+    type: go:binary
+    version: v1.26.1
+    source: github.com/bufbuild/buf/cmd/buf
+  - name: kind
+    type: http:binary
+    version: v0.20.0
+    source: '`+srv.URL+`/kind/{{ .Version }}/{{ .OS }}-{{ .Arch }}'
+    option:
+      ci: skip
+      shas:
+        linux-amd64: sha256:stale
+        darwin-arm64: sha256:stale
+`), 0o644))
+	config := filepath.Join(dir, ".magetools.yaml")
+	data := []byte(`include:
+  - baseline/tools.yaml
+tools:
+  # A newer kind than the baseline one.
+  - name: kind
+    version: v0.21.0
+    option:
+      shas: {}
+  - name: buf
+    type: http:archive
+    version: v1.29.0
+    source: https://github.com/bufbuild/buf/releases/download/{{ .Version }}/buf-{{ .OSArch }}{{ .Ext }}
+  - name: buf
+    type: http:archive
+    version: v1.28.1
+    source: https://github.com/bufbuild/buf/releases/download/{{ .Version }}/buf-{{ .OSArch }}{{ .Ext }}
+`)
+	require.NoError(t, os.WriteFile(config, data, 0o644))
+	opts := Options{Cache: NewCache(t.TempDir()), Retry: &RetryPolicy{Attempts: 1, Backoff: time.Millisecond}}
+
+	merged, err := Merge(context.Background(), dir, data, opts)
+	require.NoError(t, err)
+	require.Equal(t, `tools:
+  # from `+srv.URL+`/company.yaml
+  - name: gosimports
+    type: go:binary
+    version: v0.3.5
+    source: github.com/rinchsan/gosimports/cmd/gosimports
+  # from `+filepath.Join(dir, "baseline", "tools.yaml")+`, overridden
+  - name: buf
+    type: http:archive
+    version: v1.29.0
+    source: https://github.com/bufbuild/buf/releases/download/{{ .Version }}/buf-{{ .OSArch }}{{ .Ext }}
+  # from `+filepath.Join(dir, "baseline", "tools.yaml")+`, overridden
+  - name: kind
+    type: http:binary
+    version: v0.21.0
+    source: '`+srv.URL+`/kind/{{ .Version }}/{{ .OS }}-{{ .Arch }}'
+    option:
+      ci: skip
+      shas: {}
+  - name: buf
+    type: http:archive
+    version: v1.28.1
+    source: https://github.com/bufbuild/buf/releases/download/{{ .Version }}/buf-{{ .OSArch }}{{ .Ext }}
+verify: warn
+`, string(merged))
+	require.Equal(t, 1, requests)
+
+	installables, err := LoadGraph(merged)
+	require.NoError(t, err)
+	require.Equal(t, []string{"buf@v1.28.1", "buf@v1.29.0", "gosimports@v0.3.5", "kind@v0.21.0"}, installables.Versions())
+	require.Equal(t, VerifyWarn, installables.Verify())
+
+	// The remote file is kept in the cache, and its sha is verified.
+	opts.Offline = true
+	_, err = Merge(context.Background(), dir, data, opts)
+	require.NoError(t, err)
+	require.Equal(t, 1, requests)
+	opts.Offline = false
+	remote = []byte("tools: []\n")
+	_, err = Merge(context.Background(), dir, data, Options{Retry: opts.Retry})
+	require.ErrorIs(t, err, ErrEntryInvalid)
+
+	// The overriding kind is checksummed as merged with the included one, from its source, and
+	// gets its shas in its own file.
+	updated, err := UpdateFileChecksums(context.Background(), config, opts, "kind")
+	require.NoError(t, err)
+	kind := sha256.Sum256([]byte("/kind/v0.21.0/linux-amd64"))
+	require.Contains(t, string(updated), `  - name: kind
+    version: v0.21.0
+    option:
+      shas:
+        darwin-amd64: sha256:`)
+	require.Contains(t, string(updated), "linux-amd64: sha256:"+hex.EncodeToString(kind[:]))
+
+	// A file including itself fails.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "baseline", "tools.yaml"), []byte("include: [../.magetools.yaml]\n"), 0o644))
+	_, err = Merge(context.Background(), dir, data, opts)
+	require.ErrorContains(t, err, "is included by itself")
+}
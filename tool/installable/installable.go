@@ -6,6 +6,11 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -14,28 +19,314 @@ import (
 // ErrInstallableAlreadyInstalled notifies already installed.
 var ErrInstallableAlreadyInstalled = errors.New("already installed")
 
-// Load loads all installables.
+// hostPlatform is the "os-arch" key of the running platform, as used in shas and the lock.
+var hostPlatform = runtime.GOOS + "-" + runtime.GOARCH
+
+// Load loads all installables by name, the default version of each. See LoadGraph for all their
+// versions, dependencies and groups.
 func Load(data []byte) (Installables, error) {
-	loaded := new(entries)
-	if err := yaml.Unmarshal(data, &loaded); err != nil {
+	g, err := LoadGraph(data)
+	if err != nil {
 		return nil, err
 	}
-	installables := make(Installables, len(loaded.Data))
+	return g.byName, nil
+}
+
+// LoadGraph loads all installables, with their dependencies: the runtime, if any, and the deps of
+// each entry. Several entries of a name with different versions are installed side by side, the
+// last one being the default. Problems are reported together, each as a *ConfigError.
+func LoadGraph(data []byte) (Graph, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return Graph{}, err
+	}
+	loaded := new(entries)
+	var root *yaml.Node
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+		if err := root.Decode(loaded); err != nil {
+			return Graph{}, errors.Join(Entry{}.configErrors(err)...)
+		}
+	}
+
+	var errs []error
+	if root != nil {
+		errs = append(errs, checkFields(root, reflect.TypeOf(*loaded), "")...)
+	}
+	if len(loaded.Include) > 0 {
+		configErr := &ConfigError{Field: "include", Err: errors.New("is only supported once merged, see Merge")}
+		configErr.locate(root)
+		errs = append(errs, configErr)
+	}
+	if err := loaded.Verify.validate(); err != nil {
+		configErr := &ConfigError{Err: err}
+		configErr.locate(mappingValue(root, "verify"))
+		errs = append(errs, configErr)
+	}
+	byName := make(Installables, len(loaded.Data))
+	versions := make(map[string]Installable, len(loaded.Data))
+	errs = append(errs, loaded.checkDuplicates()...)
 	for _, e := range loaded.Data {
-		resolved, err := e.resolve(loaded)
+		if entryErrs := e.validate(); len(entryErrs) > 0 {
+			errs = append(errs, entryErrs...)
+			continue
+		}
+		resolved, err := loaded.resolveVersion(e.Name, e.Version)
 		if err != nil {
-			return nil, ErrEntryInvalid
+			errs = append(errs, e.configErrors(err)...)
+			continue
 		}
-		installables[e.Name] = resolved
+		versions[e.Versioned()] = resolved
+		if byName[e.Name], err = loaded.resolve(e.Name); err != nil {
+			// Reported with the last entry of the name.
+			delete(byName, e.Name)
+		}
+	}
+	names := loaded.names()
+	for _, e := range loaded.Data {
+		deps := mappingValue(e.node, "deps")
+		for idx, dep := range e.Deps {
+			name, version, _ := strings.Cut(dep, "@")
+			if _, ok := loaded.find(name, version); ok {
+				continue
+			}
+			configErr := &ConfigError{
+				Entry:      e.Name,
+				Field:      "deps",
+				Err:        fmt.Errorf("unknown dependency %q", dep),
+				Suggestion: suggest(dep, names),
+			}
+			configErr.locate(e.node)
+			if deps != nil && idx < len(deps.Content) {
+				configErr.locate(deps.Content[idx])
+			}
+			errs = append(errs, configErr)
+		}
+	}
+
+	// Built from the valid entries, so a cycle is reported along with other problems.
+	g := NewGraph(byName)
+	g.verify = loaded.Verify
+	for idx, e := range loaded.Data {
+		resolved, ok := loaded.resolved[idx]
+		if !ok {
+			continue
+		}
+		member := e.Name
+		if resolved != byName[e.Name] {
+			member = e.Versioned()
+		}
+		for _, group := range e.Groups {
+			g.groups[group] = append(g.groups[group], member)
+		}
+		if condition, _ := e.condition(); condition != nil {
+			g.conditions[resolved] = condition
+		}
+	}
+	for versioned, resolved := range versions {
+		g.versions[versioned] = resolved
+		if runtime := resolved.Runtime(); runtime != nil {
+			g.addDep(resolved, runtime)
+		}
+	}
+	for idx, e := range loaded.Data {
+		resolved, ok := loaded.resolved[idx]
+		if !ok {
+			continue
+		}
+		for _, dep := range e.Deps {
+			if dependency, err := loaded.resolveDep(dep); err == nil {
+				g.addDep(resolved, dependency)
+			}
+		}
+	}
+	if cycle := g.cycle(); cycle != nil {
+		errs = append(errs, loaded.cycleError(g, cycle))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return Graph{}, err
 	}
-	return installables, nil
+	return g, nil
+}
+
+// cycleError reports cycle, located at the dependency of its first installable on the second one.
+func (e *entries) cycleError(g Graph, cycle []Installable) error {
+	names := make([]string, 0, len(cycle)+1)
+	for _, installable := range append(cycle, cycle[0]) {
+		names = append(names, g.Name(installable))
+	}
+	configErr := &ConfigError{
+		Entry: names[0],
+		Err:   fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(names, " -> ")),
+	}
+	for idx, resolved := range e.resolved {
+		if resolved != cycle[0] {
+			continue
+		}
+		entry := e.Data[idx]
+		configErr.locate(entry.node)
+		deps := mappingValue(entry.node, "deps")
+		depIdx := slices.IndexFunc(entry.Deps, func(dep string) bool {
+			dependency, err := e.resolveDep(dep)
+			return err == nil && dependency == cycle[1%len(cycle)]
+		})
+		if depIdx >= 0 && deps != nil && depIdx < len(deps.Content) {
+			configErr.Field = "deps"
+			configErr.locate(deps.Content[depIdx])
+		}
+	}
+	return configErr
 }
 
 // Installables is a map of name to installable.
 type Installables map[string]Installable
 
-// ResolveInfo resolves info about an installable.
+// ResolveInfo resolves info about an installable, as Graph.ResolveInfo does, with the runtime of
+// each installable as its only dependency.
 func (i Installables) ResolveInfo(name string) (Info, error) {
+	return NewGraph(i).ResolveInfo(name)
+}
+
+// Graph holds installables by name, along with their versions, dependencies and groups.
+type Graph struct {
+	byName Installables
+	// versions holds installables by name@version, including the ones other than the default of a
+	// name.
+	versions map[string]Installable
+	deps     map[Installable][]Installable
+	// groups holds the names of the members of each group, e.g. buf, or buf@v1.26.1 for a version
+	// other than the default.
+	groups map[string][]string
+	// conditions holds the when: conditions of installables, if any.
+	conditions map[Installable]*Condition
+	verify     VerifyPolicy
+}
+
+// NewGraph returns the graph of installables, each depending on its runtime, if any.
+func NewGraph(byName Installables) Graph {
+	g := Graph{
+		byName:     byName,
+		versions:   make(map[string]Installable),
+		deps:       make(map[Installable][]Installable),
+		groups:     make(map[string][]string),
+		conditions: make(map[Installable]*Condition),
+	}
+	for _, installable := range byName {
+		if runtime := installable.Runtime(); runtime != nil {
+			g.addDep(installable, runtime)
+		}
+	}
+	return g
+}
+
+// Get returns the installable of name, or of a version of it, e.g. buf@v1.26.1.
+func (g Graph) Get(name string) (Installable, bool) {
+	if strings.Contains(name, "@") {
+		installable, ok := g.versions[name]
+		return installable, ok
+	}
+	installable, ok := g.byName[name]
+	return installable, ok
+}
+
+// Versions returns the name@version of all installables, sorted.
+func (g Graph) Versions() []string {
+	versions := make([]string, 0, len(g.versions))
+	for versioned := range g.versions {
+		versions = append(versions, versioned)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// IsDefault tells whether installable is the default version of its name.
+func (g Graph) IsDefault(installable Installable) bool {
+	for _, candidate := range g.byName {
+		if candidate == installable {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify returns how artifacts without a digest are installed, as set for the whole file.
+func (g Graph) Verify() VerifyPolicy {
+	return g.verify.or(VerifyRequired)
+}
+
+// Groups returns the names of the groups, sorted.
+func (g Graph) Groups() []string {
+	groups := make([]string, 0, len(g.groups))
+	for group := range g.groups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// Group returns the names of the members of group, in the order of their entries, to be resolved
+// with ResolveInfo. Their dependencies, e.g. runtimes, are not members, but resolved along.
+func (g Graph) Group(group string) ([]string, error) {
+	members, ok := g.groups[group]
+	if !ok {
+		if suggestion := suggest(group, g.Groups()); suggestion != "" {
+			return nil, fmt.Errorf("unknown group: %s, %s %w", group, suggestion, ErrEntryInvalid)
+		}
+		return nil, fmt.Errorf("unknown group: %s %w", group, ErrEntryInvalid)
+	}
+	return members, nil
+}
+
+// Condition returns the condition installable is installed on, or nil when it is always installed.
+func (g Graph) Condition(installable Installable) *Condition {
+	return g.conditions[installable]
+}
+
+// Names returns the names of all installables, sorted.
+func (g Graph) Names() []string {
+	names := make([]string, 0, len(g.byName))
+	for name := range g.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Name returns the name of installable i, or an empty string when it is unknown.
+func (g Graph) Name(installable Installable) string {
+	for name, candidate := range g.byName {
+		if candidate == installable {
+			return name
+		}
+	}
+	for versioned, candidate := range g.versions {
+		if candidate == installable {
+			name, _, _ := strings.Cut(versioned, "@")
+			return name
+		}
+	}
+	return ""
+}
+
+// Versioned returns the name of installable with its version, e.g. buf@v1.26.1.
+func (g Graph) Versioned(installable Installable) string {
+	for versioned, candidate := range g.versions {
+		if candidate == installable {
+			return versioned
+		}
+	}
+	return ""
+}
+
+// Deps returns the direct dependencies of installable, its runtime first.
+func (g Graph) Deps(installable Installable) []Installable {
+	return g.deps[installable]
+}
+
+// ResolveInfo resolves info about an installable, e.g. buf, buf@v1.26.1 or buf:protoc-gen-buf-lint
+// for another binary of it. Its installers are the transitive closure of its
+// dependencies followed by the installable itself, in installation order.
+func (g Graph) ResolveInfo(name string) (Info, error) {
 	info := Info{Key: name, Binary: name}
 	if strings.Contains(name, ":") {
 		parts := strings.Split(name, ":")
@@ -45,24 +336,66 @@ func (i Installables) ResolveInfo(name string) (Info, error) {
 		info.Key = parts[0]
 		info.Binary = parts[1]
 	}
+	if name, _, ok := strings.Cut(info.Binary, "@"); ok {
+		info.Binary = name
+	}
 
-	installer, ok := i[info.Key]
+	installer, ok := g.Get(info.Key)
 	if !ok {
 		return info, fmt.Errorf("unknown name: %s %w", name, ErrEntryInvalid)
 	}
-	if installer.Runtime() != nil {
-		info.Installers = append(info.Installers, installer.Runtime())
-	}
-	info.Installers = append(info.Installers, installer)
+	info.Installers = g.closure(installer)
 	return info, nil
 }
 
 // Installable gives signature of an installable.
 type Installable interface {
-	Install(context.Context, string) (string, error)
+	Install(context.Context, string, Options) (string, error)
 	Runtime() Installable
 }
 
+// Options holds settings shared by installables during an installation.
+type Options struct {
+	// Lock pins and records what installables resolve to. A nil Lock disables locking.
+	Lock *Lock
+
+	// Retry controls how failed downloads are retried. DefaultRetryPolicy is used when unset.
+	Retry *RetryPolicy
+
+	// Cache is consulted before downloading artifacts, and keeps downloaded ones. A nil Cache
+	// disables caching.
+	Cache *Cache
+
+	// Offline forbids networking: artifacts missing from Cache fail with a *MissingArtifactError.
+	Offline bool
+
+	// Verify is how artifacts without a digest are installed, unless their entry sets it. It
+	// defaults to VerifyRequired.
+	Verify VerifyPolicy
+
+	// TrustDir is where the digests of artifacts trusted on first use are recorded.
+	TrustDir string
+
+	// LockName is the name the installable is locked as, instead of its own, e.g. buf@v1.26.1 for a
+	// version installed side by side with the default one.
+	LockName string
+}
+
+// lockName returns the name an installable of name is locked as.
+func (o Options) lockName(name string) string {
+	if o.LockName != "" {
+		return o.LockName
+	}
+	return name
+}
+
+func (o Options) retryPolicy() RetryPolicy {
+	if o.Retry == nil {
+		return DefaultRetryPolicy
+	}
+	return *o.Retry
+}
+
 // Info provides list of installers of a Key.
 type Info struct {
 	Key        string
@@ -70,30 +403,54 @@ type Info struct {
 	Installers []Installable
 }
 
-// option is possible options for an installable.
-type option interface {
-	goBinaryOption | httpArchiveOption | httpBinaryOption | npmBinaryOption
-}
-
-func checkInstalled(dir, prefix, current, ci string) error {
-	if ci == "skip" && os.Getenv("CI") == "true" {
-		return ErrInstallableAlreadyInstalled
-	}
+func checkInstalled(dir, current string) error {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return err
 	}
 
+	// Other versions are kept side by side, until pruned.
 	for _, entry := range entries {
 		if entry.Name() == current { // TODO(dio): Check content.
 			return ErrInstallableAlreadyInstalled
 		}
-
-		if entry.IsDir() && strings.HasPrefix(entry.Name(), prefix+"@") {
-			// TODO(dio): Remove this when we need/allow multiple versions. Note that we also need
-			// to have a querier (for sorting paths with the right order, or pointing to the right binary).
-			return os.RemoveAll(path.Join(dir, entry.Name()))
-		}
 	}
 	return nil
 }
+
+// removeLeftovers removes what interrupted downloads or builds of name left in dir, i.e. the
+// temporary files and directories prefixed by name. Callers either hold the tool lock or own dir,
+// so nobody else is writing them.
+func removeLeftovers(dir, name string) {
+	leftovers, _ := filepath.Glob(path.Join(dir, name+"-*"))
+	for _, leftover := range leftovers {
+		_ = os.RemoveAll(leftover)
+	}
+}
+
+// stage builds an installation of versioned in a staging directory, and moves it to dst only when
+// build succeeds. Since checkInstalled treats whatever is in dst as installed, an interrupted or
+// failed build must never leave anything there.
+func stage(dst, versioned string, build func(staging string) error) error {
+	stagingDir := path.Join(dst, ".staging")
+	if err := os.MkdirAll(stagingDir, os.ModePerm); err != nil {
+		return err
+	}
+	removeLeftovers(stagingDir, versioned)
+
+	staging, err := os.MkdirTemp(stagingDir, versioned+"-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(staging)
+	}()
+	if err = os.Chmod(staging, 0o755); err != nil {
+		return err
+	}
+
+	if err = build(staging); err != nil {
+		return err
+	}
+	return os.Rename(staging, path.Join(dst, versioned))
+}
@@ -0,0 +1,37 @@
+package installable
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStage(t *testing.T) {
+	dst := t.TempDir()
+	require.NoError(t, os.MkdirAll(path.Join(dst, ".staging", "buf@v1.29.0-interrupted"), os.ModePerm))
+
+	err := stage(dst, "buf@v1.29.0", func(staging string) error {
+		require.NoError(t, os.WriteFile(path.Join(staging, "buf"), nil, 0o600))
+		return errors.New("checksum mismatch")
+	})
+	require.Error(t, err)
+	require.NoDirExists(t, path.Join(dst, "buf@v1.29.0"))
+	require.NoError(t, checkInstalled(dst, "buf@v1.29.0"))
+
+	require.NoError(t, stage(dst, "buf@v1.29.0", func(staging string) error {
+		return os.MkdirAll(path.Join(staging, "bin"), os.ModePerm)
+	}))
+	require.DirExists(t, path.Join(dst, "buf@v1.29.0", "bin"))
+	require.ErrorIs(t, checkInstalled(dst, "buf@v1.29.0"), ErrInstallableAlreadyInstalled)
+
+	// Another version is installed side by side.
+	require.NoError(t, checkInstalled(dst, "buf@v1.26.1"))
+	require.DirExists(t, path.Join(dst, "buf@v1.29.0"))
+
+	leftovers, err := os.ReadDir(path.Join(dst, ".staging"))
+	require.NoError(t, err)
+	require.Empty(t, leftovers)
+}
@@ -0,0 +1,299 @@
+package installable
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrLockMismatch notifies that the lock disagrees with the config or with what was installed.
+var ErrLockMismatch = errors.New("lock mismatch")
+
+// Lock pins what each tool resolved to and produced, per platform.
+type Lock struct {
+	Tools map[string]*LockedTool `yaml:"tools"`
+
+	// Frozen turns any disagreement between the lock and the config into an error, and keeps the
+	// lock untouched.
+	Frozen bool `yaml:"-"`
+
+	mu      sync.Mutex
+	changed bool
+}
+
+// LockedTool holds the config a tool was locked with, and its artifacts keyed by "os-arch".
+type LockedTool struct {
+	Version   string                    `yaml:"version"`
+	Type      string                    `yaml:"type"`
+	Source    string                    `yaml:"source"`
+	Artifacts map[string]LockedArtifact `yaml:"artifacts,omitempty"`
+}
+
+// LockedArtifact is what a tool resolved to on a platform.
+type LockedArtifact struct {
+	// URL is the resolved download URL. For go:binary this is module@version.
+	URL string `yaml:"url"`
+	// Digest is the digest of the downloaded artifact, e.g. "sha256:<hex>". For go:binary this is
+	// the module hash, and for npm:binary this is the tarball integrity.
+	Digest string `yaml:"digest,omitempty"`
+	// Files lists the files installed in the binary directory.
+	Files []string `yaml:"files,omitempty"`
+}
+
+// LoadLock loads a lock from data.
+func LoadLock(data []byte) (*Lock, error) {
+	l := new(Lock)
+	if err := yaml.Unmarshal(data, l); err != nil {
+		return nil, err
+	}
+	if l.Tools == nil {
+		l.Tools = make(map[string]*LockedTool)
+	}
+	return l, nil
+}
+
+// Marshal encodes the lock.
+func (l *Lock) Marshal() ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(l); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// Changed returns true when the lock has been modified since it was loaded.
+func (l *Lock) Changed() bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.changed
+}
+
+// Retain drops locked tools that are not listed in names.
+func (l *Lock) Retain(names []string) {
+	if l == nil || l.Frozen {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for name := range l.Tools {
+		if !slices.Contains(names, name) {
+			delete(l.Tools, name)
+			l.changed = true
+		}
+	}
+}
+
+// Merge adds the tools and platforms of other missing from the lock, e.g. from a restored bundle.
+func (l *Lock) Merge(other *Lock) {
+	if l == nil || other == nil || l.Frozen {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.Tools == nil {
+		l.Tools = make(map[string]*LockedTool)
+	}
+	for name, tool := range other.Tools {
+		locked, ok := l.Tools[name]
+		if !ok {
+			locked = &LockedTool{Version: tool.Version, Type: tool.Type, Source: tool.Source}
+			l.Tools[name] = locked
+		}
+		if !sameConfig(locked, *tool) {
+			continue
+		}
+		for platform, artifact := range tool.Artifacts {
+			if _, ok := locked.Artifacts[platform]; ok {
+				continue
+			}
+			if locked.Artifacts == nil {
+				locked.Artifacts = make(map[string]LockedArtifact)
+			}
+			locked.Artifacts[platform] = artifact
+			l.changed = true
+		}
+	}
+}
+
+// Digest returns the digest locked for the tool on platform, or an empty string when the lock has
+// none.
+func (l *Lock) Digest(name, platform string, tool LockedTool) string {
+	if l == nil {
+		return ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	locked, ok := l.Tools[name]
+	if !ok || !sameConfig(locked, tool) {
+		return ""
+	}
+	return locked.Artifacts[platform].Digest
+}
+
+// Check verifies that the config of a tool agrees with the lock. It only fails in frozen mode,
+// before anything is installed nor removed, so installables then return no installed path.
+func (l *Lock) Check(name string, tool LockedTool) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.pinned(name, hostPlatform, tool)
+	return err
+}
+
+// Verify verifies that artifact agrees with the one pinned for the tool on this platform. A
+// different digest for the same config is always an error.
+func (l *Lock) Verify(name string, tool LockedTool, artifact LockedArtifact) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.verify(name, hostPlatform, tool, artifact)
+	return err
+}
+
+// Record verifies and records artifact as what the tool resolved to on this platform.
+func (l *Lock) Record(name string, tool LockedTool, artifact LockedArtifact) error {
+	return l.RecordFor(name, hostPlatform, tool, artifact)
+}
+
+// RecordFor verifies and records artifact as what the tool resolved to on platform, e.g.
+// linux-amd64.
+func (l *Lock) RecordFor(name, platform string, tool LockedTool, artifact LockedArtifact) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	pinned, err := l.verify(name, platform, tool, artifact)
+	if err != nil {
+		return err
+	}
+	if pinned != nil {
+		if artifact.Digest == "" {
+			artifact.Digest = pinned.Digest
+		}
+		// Files are unknown when the artifact was locked without being installed, e.g. when
+		// vendored for another platform.
+		if artifact.Files == nil {
+			artifact.Files = pinned.Files
+		}
+		if pinned.URL == artifact.URL && pinned.Digest == artifact.Digest &&
+			(slices.Equal(pinned.Files, artifact.Files) || l.Frozen && pinned.Files == nil) {
+			return nil
+		}
+	}
+	if l.Frozen {
+		return fmt.Errorf("%s: installed files differ from the lock: %w", name, ErrLockMismatch)
+	}
+
+	if l.Tools == nil {
+		l.Tools = make(map[string]*LockedTool)
+	}
+	locked, ok := l.Tools[name]
+	if !ok || !sameConfig(locked, tool) {
+		locked = &LockedTool{Version: tool.Version, Type: tool.Type, Source: tool.Source}
+		l.Tools[name] = locked
+	}
+	if locked.Artifacts == nil {
+		locked.Artifacts = make(map[string]LockedArtifact)
+	}
+	locked.Artifacts[platform] = artifact
+	l.changed = true
+	return nil
+}
+
+func (l *Lock) verify(name, platform string, tool LockedTool, artifact LockedArtifact) (*LockedArtifact, error) {
+	pinned, err := l.pinned(name, platform, tool)
+	if err != nil || pinned == nil {
+		return nil, err
+	}
+	if pinned.Digest != "" && artifact.Digest != "" && pinned.Digest != artifact.Digest {
+		return nil, fmt.Errorf("%s: digest %s differs from locked %s: %w", name, artifact.Digest, pinned.Digest, ErrLockMismatch)
+	}
+	if l.Frozen && pinned.URL != artifact.URL {
+		return nil, fmt.Errorf("%s: url %s differs from locked %s: %w", name, artifact.URL, pinned.URL, ErrLockMismatch)
+	}
+	return pinned, nil
+}
+
+// pinned returns the artifact locked for the tool on platform, or nil when the lock has nothing
+// for it. In frozen mode, anything missing or different is an error.
+func (l *Lock) pinned(name, platform string, tool LockedTool) (*LockedArtifact, error) {
+	locked, ok := l.Tools[name]
+	if !ok {
+		if l.Frozen {
+			return nil, fmt.Errorf("%s is not locked: %w", name, ErrLockMismatch)
+		}
+		return nil, nil
+	}
+	if !sameConfig(locked, tool) {
+		if l.Frozen {
+			return nil, fmt.Errorf("%s: config %s@%s differs from locked %s@%s: %w",
+				name, tool.Type, tool.Version, locked.Type, locked.Version, ErrLockMismatch)
+		}
+		return nil, nil
+	}
+	artifact, ok := locked.Artifacts[platform]
+	if !ok {
+		if l.Frozen {
+			return nil, fmt.Errorf("%s is not locked for %s: %w", name, platform, ErrLockMismatch)
+		}
+		return nil, nil
+	}
+	return &artifact, nil
+}
+
+func sameConfig(locked *LockedTool, tool LockedTool) bool {
+	return locked.Version == tool.Version && locked.Type == tool.Type && locked.Source == tool.Source
+}
+
+// lockInstalled records artifact with the files installed in dir.
+func lockInstalled(l *Lock, name string, tool LockedTool, artifact LockedArtifact, dir string) error {
+	return lockInstalledFor(l, name, hostPlatform, tool, artifact, dir)
+}
+
+// lockInstalledFor records artifact for platform with the files installed in dir.
+func lockInstalledFor(l *Lock, name, platform string, tool LockedTool, artifact LockedArtifact, dir string) error {
+	files, err := installedFiles(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// No files to record, e.g. an installation without a bin directory.
+			return nil
+		}
+		return err
+	}
+	artifact.Files = files
+	return l.RecordFor(name, platform, tool, artifact)
+}
+
+func installedFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,68 @@
+package installable
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	helm := LockedTool{Version: "v3.12.3", Type: httpArchiveType, Source: "https://get.helm.sh/helm-{{ .Version }}"}
+	artifact := LockedArtifact{URL: "https://get.helm.sh/helm-v3.12.3", Digest: "sha256:1b23", Files: []string{"helm"}}
+
+	{
+		l, err := LoadLock(nil)
+		require.NoError(t, err)
+		require.NoError(t, l.Check("helm", helm))
+		require.NoError(t, l.Record("helm", helm, artifact))
+		require.True(t, l.Changed())
+
+		data, err := l.Marshal()
+		require.NoError(t, err)
+		l, err = LoadLock(data)
+		require.NoError(t, err)
+		require.Equal(t, artifact, l.Tools["helm"].Artifacts[hostPlatform])
+
+		// Same config, different bytes.
+		tampered := artifact
+		tampered.Digest = "sha256:ffff"
+		require.ErrorIs(t, l.Verify("helm", helm, tampered), ErrLockMismatch)
+
+		// A new version replaces the locked one.
+		upgraded := helm
+		upgraded.Version = "v3.13.0"
+		require.NoError(t, l.Record("helm", upgraded, tampered))
+		require.Equal(t, "v3.13.0", l.Tools["helm"].Version)
+
+		l.Retain([]string{"kubectl"})
+		require.Empty(t, l.Tools)
+	}
+
+	{
+		l, err := LoadLock(nil)
+		require.NoError(t, err)
+		l.Frozen = true
+		require.ErrorIs(t, l.Check("helm", helm), ErrLockMismatch)
+	}
+
+	{
+		l, err := LoadLock(nil)
+		require.NoError(t, err)
+		require.NoError(t, l.Record("helm", helm, artifact))
+		l.Frozen = true
+		require.NoError(t, l.Check("helm", helm))
+		require.NoError(t, l.Record("helm", helm, artifact))
+
+		upgraded := helm
+		upgraded.Version = "v3.13.0"
+		require.ErrorIs(t, l.Check("helm", upgraded), ErrLockMismatch)
+
+		moved := artifact
+		moved.URL = "https://mirror.local/helm-v3.12.3"
+		require.ErrorIs(t, l.Verify("helm", helm, moved), ErrLockMismatch)
+
+		extra := artifact
+		extra.Files = []string{"helm", "tiller"}
+		require.ErrorIs(t, l.Record("helm", helm, extra), ErrLockMismatch)
+	}
+}
@@ -2,9 +2,12 @@ package installable
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"path"
+	"strings"
 
 	"github.com/magefile/mage/sh"
 )
@@ -13,7 +16,8 @@ var npmBinaryType = "npm:binary"
 
 type npmBinaryOption struct {
 	Runtime string `yaml:"runtime"`
-	CI      string `yaml:"ci"`
+	// CI set to skip skips the tool on CI, as when: !ci does.
+	CI string `yaml:"ci"`
 }
 
 type npmBinary struct {
@@ -25,22 +29,154 @@ type npmBinary struct {
 	option    npmBinaryOption
 }
 
-func (a *npmBinary) Install(_ context.Context, dst string) (string, error) {
+func newNPMBinary(e Entry) (Installable, error) {
+	opt, err := typedOption[npmBinaryOption](e)
+	if err != nil {
+		return nil, err
+	}
+	bin := &npmBinary{
+		name:      e.Name,
+		source:    e.Source,
+		version:   e.Version,
+		versioned: e.Versioned(),
+		option:    *opt,
+	}
+	if opt.Runtime != "" {
+		// Without other entries, e.g. when resolved alone, the runtime is the one of the system.
+		bin.runtime, err = e.Resolve(opt.Runtime)
+		switch {
+		case errors.Is(err, ErrEntryNotFound) && e.all != nil:
+			return nil, &ConfigError{
+				Field:      "option.runtime",
+				Err:        fmt.Errorf("unknown runtime %q", opt.Runtime),
+				Suggestion: suggest(opt.Runtime, e.all.names()),
+			}
+		case err != nil && !errors.Is(err, ErrEntryNotFound):
+			return nil, err
+		}
+	}
+	return bin, nil
+}
+
+func (a *npmBinary) Install(_ context.Context, dst string, opts Options) (string, error) {
 	installed := path.Join(dst, a.versioned, "node_modules", ".bin")
 
-	if err := checkInstalled(dst, a.name, a.versioned, a.option.CI); err != nil {
+	if err := opts.Lock.Check(opts.lockName(a.name), a.locked()); err != nil {
+		return "", err
+	}
+	if err := checkInstalled(dst, a.versioned); err != nil {
 		if errors.Is(err, ErrInstallableAlreadyInstalled) {
-			return installed, nil
+			return installed, a.lock(opts.Lock, opts.lockName(a.name), hostPlatform, path.Join(dst, a.versioned), installed)
 		}
 		return installed, err
 	}
-	fmt.Printf("Installing %s", a.versioned)
-	fmt.Println()
+	output.Printf("Installing %s", a.versioned)
+
+	return installed, stage(dst, a.versioned, func(staging string) error {
+		bin := path.Join(staging, "node_modules", ".bin")
+		// Packages installed earlier, e.g. by another project, are reused from the cache.
+		key := a.treeKey(hostPlatform)
+		if tree, release, ok := opts.Cache.findTree(key); ok {
+			defer release()
+			if err := copyTree(tree, staging, opts.Cache.Link); err != nil {
+				return err
+			}
+			return a.lock(opts.Lock, opts.lockName(a.name), hostPlatform, staging, bin)
+		}
+		if opts.Offline {
+			return &MissingArtifactError{Tool: a.versioned, Platform: hostPlatform, Source: a.source + "@" + a.version}
+		}
 
-	return installed,
-		sh.RunV("npm", "install", "--prefix", path.Join(dst, a.versioned), a.source+"@"+a.version)
+		if err := a.build(staging, hostPlatform); err != nil {
+			return err
+		}
+		if err := a.lock(opts.Lock, opts.lockName(a.name), hostPlatform, staging, bin); err != nil {
+			return err
+		}
+		return opts.Cache.putTree(key, staging)
+	})
+}
+
+func (a *npmBinary) Vendor(_ context.Context, platform string, opts Options) ([]string, error) {
+	tree, rel, err := vendorTree(a.treeKey(platform), a.versioned, platform, a.source+"@"+a.version, func(dir string) error {
+		return a.build(dir, platform)
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []string{rel}, a.lock(opts.Lock, opts.lockName(a.name), platform, tree, path.Join(tree, "node_modules", ".bin"))
+}
+
+// build installs the package for platform into prefix. Packages with native binaries usually pick
+// them in optional dependencies matching the os and cpu npm installs for.
+func (a *npmBinary) build(prefix, platform string) error {
+	args := []string{"install", "--prefix", prefix}
+	if platform != hostPlatform {
+		goos, goarch, _ := strings.Cut(platform, "-")
+		args = append(args, "--os", npmOS(goos), "--cpu", npmCPU(goarch))
+	}
+	return sh.RunV("npm", append(args, a.source+"@"+a.version)...)
+}
+
+func (a *npmBinary) treeKey(platform string) string {
+	return npmBinaryType + " " + a.source + "@" + a.version + " " + platform
+}
+
+// npmOS returns the name of goos in Node.js, i.e. process.platform.
+func npmOS(goos string) string {
+	if goos == "windows" {
+		return "win32"
+	}
+	return goos
+}
+
+// npmCPU returns the name of goarch in Node.js, i.e. process.arch.
+func npmCPU(goarch string) string {
+	switch goarch {
+	case "amd64":
+		return "x64"
+	case "386":
+		return "ia32"
+	}
+	return goarch
 }
 
 func (a *npmBinary) Runtime() Installable {
 	return a.runtime
 }
+
+func (a *npmBinary) locked() LockedTool {
+	return LockedTool{Version: a.version, Type: npmBinaryType, Source: a.source}
+}
+
+// npmPackageLock is the part of package-lock.json we care about.
+type npmPackageLock struct {
+	Packages map[string]struct {
+		Resolved  string `json:"resolved"`
+		Integrity string `json:"integrity"`
+	} `json:"packages"`
+}
+
+// lock records the resolved tarball and its integrity for platform, as written by npm in the
+// hidden lockfile.
+func (a *npmBinary) lock(l *Lock, name, platform, prefix, installed string) error {
+	if l == nil {
+		return nil
+	}
+	data, err := os.ReadFile(path.Join(prefix, "node_modules", ".package-lock.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return lockInstalledFor(l, name, platform, a.locked(), LockedArtifact{URL: a.source + "@" + a.version}, installed)
+		}
+		return err
+	}
+	var packageLock npmPackageLock
+	if err = json.Unmarshal(data, &packageLock); err != nil {
+		return err
+	}
+	artifact := LockedArtifact{URL: a.source + "@" + a.version}
+	if pkg, ok := packageLock.Packages["node_modules/"+a.source]; ok {
+		artifact = LockedArtifact{URL: pkg.Resolved, Digest: pkg.Integrity}
+	}
+	return lockInstalledFor(l, name, platform, a.locked(), artifact, installed)
+}
@@ -0,0 +1,25 @@
+package installable
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrOffline notifies that an artifact is needed from the network while offline.
+var ErrOffline = errors.New("not available offline")
+
+// MissingArtifactError notifies that the artifact of a tool for a platform is in neither the cache
+// nor a restored bundle, while offline.
+type MissingArtifactError struct {
+	Tool     string
+	Platform string
+	Source   string
+}
+
+func (e *MissingArtifactError) Error() string {
+	return fmt.Sprintf("%s for %s from %s: %s", e.Tool, e.Platform, e.Source, ErrOffline)
+}
+
+func (e *MissingArtifactError) Unwrap() error {
+	return ErrOffline
+}
@@ -0,0 +1,86 @@
+package installable
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+)
+
+// output serializes what concurrent installations print. Messages are printed on their own lines,
+// while the progress of active downloads shares a single status line kept at the bottom.
+var output = &printer{downloads: make(map[string]uint64)}
+
+type printer struct {
+	mu        sync.Mutex
+	downloads map[string]uint64
+	width     int
+}
+
+// Printf prints a message line.
+func (p *printer) Printf(format string, args ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	fmt.Printf(format, args...)
+	fmt.Println()
+	p.render()
+}
+
+// progress updates the downloaded bytes of name.
+func (p *printer) progress(name string, total uint64) {
+	if runningOnCI {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.downloads[name] = total
+	p.render()
+}
+
+// done removes name from the active downloads, leaving its final status on its own line.
+func (p *printer) done(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	total, ok := p.downloads[name]
+	if !ok {
+		return
+	}
+	delete(p.downloads, name)
+	p.clear()
+	fmt.Fprintf(os.Stderr, "Downloading %s... %s\n", name, humanize.Bytes(total))
+	p.render()
+}
+
+func (p *printer) clear() {
+	if p.width == 0 {
+		return
+	}
+	// Clear the line by using a character return to go back to the start and remove
+	// the remaining characters by filling it with spaces.
+	fmt.Fprintf(os.Stderr, "\r%s\r", strings.Repeat(" ", p.width))
+	p.width = 0
+}
+
+func (p *printer) render() {
+	if len(p.downloads) == 0 {
+		return
+	}
+	names := make([]string, 0, len(p.downloads))
+	for name := range p.downloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	statuses := make([]string, 0, len(names))
+	for _, name := range names {
+		// We use the humanize package to print the bytes in a meaningful way (e.g. 10 MB).
+		statuses = append(statuses, fmt.Sprintf("%s... %s", name, humanize.Bytes(p.downloads[name])))
+	}
+	line := "Downloading " + strings.Join(statuses, ", ") + " "
+	p.clear()
+	fmt.Fprintf(os.Stderr, "\r%s", line)
+	p.width = len(line)
+}
@@ -0,0 +1,64 @@
+package installable
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory creates an installable from an entry of a registered type. It decodes the option of the
+// entry with Entry.DecodeOption, and resolves a runtime, if any, with Entry.Resolve.
+type Factory func(e Entry) (Installable, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+func init() {
+	Register(goBinaryType, newGoBinary)
+	Register(httpArchiveType, newHTTPArchive)
+	Register(httpBinaryType, newHTTPBinary)
+	Register(npmBinaryType, newNPMBinary)
+}
+
+// Register makes installables of typeName, e.g. "brew:formula", loadable from a .magetools.yaml
+// file. It is meant to be called from an init function. It panics when typeName is already
+// registered.
+func Register(typeName string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("installable: Register factory is nil")
+	}
+	if _, dup := registry[typeName]; dup {
+		panic(fmt.Sprintf("installable: Register called twice for type %q", typeName))
+	}
+	registry[typeName] = factory
+}
+
+// unregister removes typeName, e.g. registered by a test.
+func unregister(typeName string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	delete(registry, typeName)
+}
+
+// Types returns the registered types.
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	types := make([]string, 0, len(registry))
+	for typeName := range registry {
+		types = append(types, typeName)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func lookup(typeName string) (Factory, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	factory, ok := registry[typeName]
+	return factory, ok
+}
@@ -0,0 +1,130 @@
+package installable
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+var (
+	optionsMu sync.RWMutex
+	options   = make(map[string]reflect.Type)
+)
+
+func init() {
+	RegisterOption(goBinaryType, goBinaryOption{})
+	RegisterOption(httpArchiveType, httpArchiveOption{})
+	RegisterOption(httpBinaryType, httpBinaryOption{})
+	RegisterOption(npmBinaryType, npmBinaryOption{})
+}
+
+// RegisterOption describes the option of typeName, a struct with yaml tags as decoded by its
+// factory, in JSONSchema. The option of a registered type without one is any object.
+func RegisterOption(typeName string, option interface{}) {
+	optionsMu.Lock()
+	defer optionsMu.Unlock()
+	options[typeName] = reflect.TypeOf(option)
+}
+
+// unregisterOption removes the option of typeName, e.g. registered by a test.
+func unregisterOption(typeName string) {
+	optionsMu.Lock()
+	defer optionsMu.Unlock()
+	delete(options, typeName)
+}
+
+// JSONSchema returns the JSON Schema of .magetools.yaml files, with the option of each entry
+// described according to its type, e.g. for yaml-language-server.
+func JSONSchema() ([]byte, error) {
+	types := Types()
+	optionsMu.RLock()
+	conditions := make([]interface{}, 0, len(types))
+	for _, typeName := range types {
+		option := map[string]interface{}{"type": "object"}
+		if t, ok := options[typeName]; ok {
+			option = typeSchema(t)
+		}
+		conditions = append(conditions, map[string]interface{}{
+			// Without required, an entry without type, e.g. an override, would meet every if.
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{"type": map[string]interface{}{"const": typeName}},
+				"required":   []string{"type"},
+			},
+			"then": map[string]interface{}{
+				"properties": map[string]interface{}{"option": option},
+			},
+		})
+	}
+	optionsMu.RUnlock()
+
+	entry := typeSchema(reflect.TypeOf(Entry{}))
+	// Only name: an entry overriding an included one sets only the fields it changes. Load reports
+	// missing ones once merged.
+	entry["required"] = []string{"name"}
+	entry["properties"].(map[string]interface{})["type"] = map[string]interface{}{"enum": types}
+	entry["allOf"] = conditions
+
+	schema := typeSchema(reflect.TypeOf(entries{}))
+	schema["properties"].(map[string]interface{})["tools"] = map[string]interface{}{
+		"type":  "array",
+		"items": entry,
+	}
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = ".magetools.yaml"
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+var (
+	verifyPolicyType = reflect.TypeOf(VerifyPolicy(""))
+	includeType      = reflect.TypeOf(include{})
+)
+
+// typeSchema returns the JSON Schema of t, as decoded from YAML.
+func typeSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case verifyPolicyType:
+		return map[string]interface{}{"enum": []VerifyPolicy{VerifyRequired, VerifyWarn, VerifyTOFU}}
+	case includeType:
+		// An include is also given as a path.
+		return map[string]interface{}{"anyOf": []interface{}{map[string]interface{}{"type": "string"}, structSchema(t)}}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return structSchema(t)
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type) map[string]interface{} {
+	fields := yamlFields(t)
+	properties := make(map[string]interface{}, len(fields))
+	for key, fieldType := range fields {
+		properties[key] = typeSchema(fieldType)
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
@@ -0,0 +1,78 @@
+package installable
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSchema(t *testing.T) {
+	Register("test:schema", func(e Entry) (Installable, error) {
+		return &customBinary{entry: e}, nil
+	})
+	RegisterOption("test:schema", customBinaryOption{})
+	t.Cleanup(func() {
+		unregister("test:schema")
+		unregisterOption("test:schema")
+	})
+
+	data, err := JSONSchema()
+	require.NoError(t, err)
+	var schema struct {
+		Properties struct {
+			Tools struct {
+				Items struct {
+					Required   []string `json:"required"`
+					Properties struct {
+						Type struct {
+							Enum []string `json:"enum"`
+						} `json:"type"`
+					} `json:"properties"`
+					AllOf []struct {
+						If struct {
+							Required   []string `json:"required"`
+							Properties struct {
+								Type struct {
+									Const string `json:"const"`
+								} `json:"type"`
+							} `json:"properties"`
+						} `json:"if"`
+						Then struct {
+							Properties struct {
+								Option struct {
+									Properties map[string]interface{} `json:"properties"`
+								} `json:"option"`
+							} `json:"properties"`
+						} `json:"then"`
+					} `json:"allOf"`
+				} `json:"items"`
+			} `json:"tools"`
+		} `json:"properties"`
+	}
+	require.NoError(t, json.Unmarshal(data, &schema))
+	entry := schema.Properties.Tools.Items
+	require.Equal(t, []string{"name"}, entry.Required)
+	require.Subset(t, entry.Properties.Type.Enum, []string{goBinaryType, httpArchiveType, httpBinaryType, npmBinaryType, "test:schema"})
+
+	options := make(map[string]map[string]interface{}, len(entry.AllOf))
+	for _, condition := range entry.AllOf {
+		options[condition.If.Properties.Type.Const] = condition.Then.Properties.Option.Properties
+	}
+	require.Contains(t, options[httpArchiveType], "stripPrefix")
+	require.NotContains(t, options[httpBinaryType], "stripPrefix")
+	require.Contains(t, options[npmBinaryType], "runtime")
+	require.Contains(t, options["test:schema"], "tap")
+
+	// An override without type, setting only option, is checked against no option schema.
+	override := map[string]interface{}{"name": "kubectl", "option": map[string]interface{}{"shas": map[string]interface{}{}}}
+	for _, condition := range entry.AllOf {
+		met := override["type"] == condition.If.Properties.Type.Const
+		for _, required := range condition.If.Required {
+			_, ok := override[required]
+			met = met && ok
+		}
+		require.False(t, met, condition.If.Properties.Type.Const)
+		require.Equal(t, []string{"type"}, condition.If.Required)
+	}
+}
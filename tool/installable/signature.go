@@ -0,0 +1,219 @@
+package installable
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// ErrSignatureInvalid notifies a downloaded artifact whose signature does not verify.
+var ErrSignatureInvalid = errors.New("invalid signature")
+
+const (
+	minisignType = "minisign"
+	cosignType   = "cosign"
+)
+
+// signature configures the verification of the signature of downloaded artifacts.
+type signature struct {
+	// Type is either minisign, or cosign for key-based signatures of cosign sign-blob.
+	Type string `yaml:"type"`
+	// PublicKey is the base64 key of minisign, i.e. the last line of minisign.pub, or the PEM
+	// encoded public key of cosign.
+	PublicKey string `yaml:"publicKey"`
+	// URL is the URL of the signature of the artifact, templated like the source.
+	URL string `yaml:"url"`
+}
+
+// verify verifies the signature of file at url, when configured. The signature is kept in
+// opts.Cache next to the artifact, and bundled with it, so it is verified offline too.
+func (s signature) verify(ctx context.Context, versioned, url, file string, opts Options) error {
+	if s.Type == "" {
+		return nil
+	}
+	if url == "" || s.PublicKey == "" {
+		return fmt.Errorf("%s: %s signature requires a url and a publicKey: %w", versioned, s.Type, ErrEntryInvalid)
+	}
+
+	sum, err := digestFile("sha256", file)
+	if err != nil {
+		return err
+	}
+	sig, err := os.ReadFile(opts.Cache.signaturePath(sum, s.Type))
+	fetched := false
+	switch {
+	case err == nil:
+	case opts.Offline:
+		output.Printf("WARNING: %s is not verified, its %s signature was neither cached nor bundled", versioned, s.Type)
+		return nil
+	default:
+		if sig, err = s.fetch(ctx, versioned, url, opts); err != nil {
+			return err
+		}
+		fetched = true
+	}
+
+	switch s.Type {
+	case minisignType:
+		err = verifyMinisign(s.PublicKey, sig, file)
+	case cosignType:
+		err = verifyCosign(s.PublicKey, sig, file)
+	default:
+		return fmt.Errorf("%s: unknown signature type %q: %w", versioned, s.Type, ErrEntryInvalid)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", versioned, err)
+	}
+	if fetched {
+		return opts.Cache.putSignature(sum, s.Type, sig)
+	}
+	return nil
+}
+
+// fetch downloads the signature at url.
+func (s signature) fetch(ctx context.Context, versioned, url string, opts Options) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "magetools-signature-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	downloaded, _, err := download(ctx, dir, url, versioned+".sig", opts.retryPolicy())
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(downloaded)
+}
+
+// verifyMinisign verifies the minisign signature sig of file with the base64 publicKey.
+func verifyMinisign(publicKey string, sig []byte, file string) error {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil || len(key) != 2+8+ed25519.PublicKeySize || string(key[:2]) != "Ed" {
+		return fmt.Errorf("malformed minisign public key: %w", ErrEntryInvalid)
+	}
+	keyID, pub := key[2:10], ed25519.PublicKey(key[10:])
+
+	// The lines are an untrusted comment, the signature, a trusted comment, and the global
+	// signature of the signature and the trusted comment.
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(sig))
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if len(lines) < 4 {
+		return fmt.Errorf("malformed minisign signature: %w", ErrSignatureInvalid)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(decoded) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("malformed minisign signature: %w", ErrSignatureInvalid)
+	}
+	algorithm, sigKeyID, signed := string(decoded[:2]), decoded[2:10], decoded[10:]
+	if !bytes.Equal(keyID, sigKeyID) {
+		return fmt.Errorf("minisign signature is for key %X, not %X: %w", sigKeyID, keyID, ErrSignatureInvalid)
+	}
+
+	var message []byte
+	switch algorithm {
+	case "Ed":
+		if message, err = os.ReadFile(file); err != nil {
+			return err
+		}
+	case "ED":
+		// Prehashed, the default since minisign 0.11.
+		h, err := blake2b.New512(nil)
+		if err != nil {
+			return err
+		}
+		if err = hashFile(h, file); err != nil {
+			return err
+		}
+		message = h.Sum(nil)
+	default:
+		return fmt.Errorf("unknown minisign algorithm %q: %w", algorithm, ErrSignatureInvalid)
+	}
+	if !ed25519.Verify(pub, message, signed) {
+		return fmt.Errorf("minisign signature does not match: %w", ErrSignatureInvalid)
+	}
+
+	trusted, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+	if !ok {
+		return fmt.Errorf("malformed minisign trusted comment: %w", ErrSignatureInvalid)
+	}
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || !ed25519.Verify(pub, append(signed, trusted...), global) {
+		return fmt.Errorf("minisign trusted comment does not match: %w", ErrSignatureInvalid)
+	}
+	return nil
+}
+
+// verifyCosign verifies the base64 signature sig of file, as written by cosign sign-blob, with the
+// PEM encoded publicKey.
+func verifyCosign(publicKey string, sig []byte, file string) error {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(publicKey)))
+	if block == nil {
+		return fmt.Errorf("malformed cosign public key: %w", ErrEntryInvalid)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("malformed cosign public key: %v: %w", err, ErrEntryInvalid)
+	}
+	signed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		// A raw signature.
+		signed = sig
+	}
+
+	h := sha256.New()
+	if err = hashFile(h, file); err != nil {
+		return err
+	}
+	digest := h.Sum(nil)
+
+	var ok bool
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(key, digest, signed)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signed) == nil
+	case ed25519.PublicKey:
+		message, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		ok = ed25519.Verify(key, message, signed)
+	default:
+		return fmt.Errorf("unsupported cosign public key %T: %w", pub, ErrEntryInvalid)
+	}
+	if !ok {
+		return fmt.Errorf("cosign signature does not match: %w", ErrSignatureInvalid)
+	}
+	return nil
+}
+
+func hashFile(h io.Writer, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	_, err = io.Copy(h, f)
+	return err
+}
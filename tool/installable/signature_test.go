@@ -0,0 +1,154 @@
+package installable
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisign signs message like minisign -S, prehashed unless legacy.
+func minisign(priv ed25519.PrivateKey, keyID []byte, message []byte, legacy bool) []byte {
+	algorithm := "ED"
+	if legacy {
+		algorithm = "Ed"
+	} else {
+		sum := blake2b.Sum512(message)
+		message = sum[:]
+	}
+	signed := ed25519.Sign(priv, message)
+	trusted := "timestamp:1693526400\tfile:kind"
+	global := ed25519.Sign(priv, append(append([]byte{}, signed...), trusted...))
+	return []byte("untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(append(append([]byte(algorithm), keyID...), signed...)) + "\n" +
+		"trusted comment: " + trusted + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n")
+}
+
+func TestVerifySignature(t *testing.T) {
+	file := path.Join(t.TempDir(), "kind")
+	content := []byte("#!/bin/sh\necho kind\n")
+	require.NoError(t, os.WriteFile(file, content, 0o600))
+
+	{
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		keyID := []byte("12345678")
+		publicKey := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pub...))
+
+		for _, legacy := range []bool{false, true} {
+			require.NoError(t, verifyMinisign(publicKey, minisign(priv, keyID, content, legacy), file))
+			require.ErrorIs(t, verifyMinisign(publicKey, minisign(priv, keyID, []byte("tampered"), legacy), file), ErrSignatureInvalid)
+		}
+		require.ErrorIs(t, verifyMinisign(publicKey, minisign(priv, []byte("87654321"), content, false), file), ErrSignatureInvalid)
+
+		// The trusted comment is signed too.
+		sig := minisign(priv, keyID, content, false)
+		sig = []byte(strings.Replace(string(sig), "file:kind", "file:other", 1))
+		require.ErrorIs(t, verifyMinisign(publicKey, sig, file), ErrSignatureInvalid)
+	}
+
+	{
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+		require.NoError(t, err)
+		publicKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+		digest := sha256.Sum256(content)
+		signed, err := ecdsa.SignASN1(rand.Reader, priv, digest[:])
+		require.NoError(t, err)
+		require.NoError(t, verifyCosign(publicKey, []byte(base64.StdEncoding.EncodeToString(signed)), file))
+
+		digest = sha256.Sum256([]byte("tampered"))
+		signed, err = ecdsa.SignASN1(rand.Reader, priv, digest[:])
+		require.NoError(t, err)
+		require.ErrorIs(t, verifyCosign(publicKey, []byte(base64.StdEncoding.EncodeToString(signed)), file), ErrSignatureInvalid)
+	}
+}
+
+func TestInstallVerifiesSignature(t *testing.T) {
+	content := []byte("#!/bin/sh\necho kind\n")
+	sum := sha256.Sum256(content)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyID := []byte("12345678")
+	sig := minisign(priv, keyID, []byte("tampered"), false)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".minisig") {
+			_, _ = w.Write(sig)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	bin := &httpBinary{
+		name:      "kind",
+		version:   "v0.20.0",
+		versioned: "kind@v0.20.0",
+		source:    srv.URL + "/{{ .Version }}/kind-{{ .OS }}-{{ .Arch }}",
+		option: httpBinaryOption{
+			SHAs: map[string]string{hostPlatform: "sha256:" + hex.EncodeToString(sum[:])},
+			Signature: signature{
+				Type:      minisignType,
+				PublicKey: base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pub...)),
+				URL:       srv.URL + "/{{ .Version }}/kind-{{ .OS }}-{{ .Arch }}.minisig",
+			},
+		},
+	}
+
+	// A bad signature aborts the installation.
+	dst := t.TempDir()
+	_, err = bin.Install(context.Background(), dst, Options{})
+	require.ErrorIs(t, err, ErrSignatureInvalid)
+	require.NoDirExists(t, path.Join(dst, "kind@v0.20.0"))
+
+	sig = minisign(priv, keyID, content, false)
+	installed, err := bin.Install(context.Background(), dst, Options{})
+	require.NoError(t, err)
+	require.FileExists(t, path.Join(installed, "kind"))
+
+	// Offline, the signature kept in the cache along with the artifact, and bundled with it, is
+	// verified.
+	cache := NewCache(t.TempDir())
+	_, err = bin.Install(context.Background(), t.TempDir(), Options{Cache: cache})
+	require.NoError(t, err)
+	vendored, err := bin.Vendor(context.Background(), hostPlatform, Options{Cache: cache})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		path.Join("blobs", "sha256", hex.EncodeToString(sum[:])),
+		path.Join("signatures", hex.EncodeToString(sum[:])+"."+minisignType),
+	}, vendored)
+	srv.Close()
+	_, err = bin.Install(context.Background(), t.TempDir(), Options{Cache: cache, Offline: true})
+	require.NoError(t, err)
+	signatures, err := filepath.Glob(path.Join(cache.Dir(), "signatures", "*"))
+	require.NoError(t, err)
+	require.Len(t, signatures, 1)
+	require.NoError(t, os.WriteFile(signatures[0], minisign(priv, keyID, []byte("tampered"), false), 0o600))
+	_, err = bin.Install(context.Background(), t.TempDir(), Options{Cache: cache, Offline: true})
+	require.ErrorIs(t, err, ErrSignatureInvalid)
+
+	// Without it, e.g. cached before signatures were, it is installed with a warning.
+	require.NoError(t, os.Remove(signatures[0]))
+	_, err = bin.Install(context.Background(), t.TempDir(), Options{Cache: cache, Offline: true})
+	require.NoError(t, err)
+}
@@ -0,0 +1,112 @@
+package installable
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// digestFor returns the digest the artifact of source for platform must have: as listed in shas,
+// else as pinned by the lock, e.g. when first read from a checksum file, else as listed in the
+// checksum file at checksumURL, else as allowed by policy.
+func digestFor(ctx context.Context, name, versioned, platform, source, checksumURL string, shas map[string]string, tool LockedTool, policy VerifyPolicy, opts Options) (string, error) {
+	if want := infer(shas, platform, ""); want != "" {
+		return want, nil
+	}
+	if want := opts.Lock.Digest(name, platform, tool); want != "" {
+		return want, nil
+	}
+	if checksumURL == "" {
+		return unverified(versioned, platform, policy, opts)
+	}
+	if opts.Offline {
+		return "", &MissingArtifactError{Tool: versioned, Platform: platform, Source: checksumURL}
+	}
+
+	dir, err := os.MkdirTemp("", "magetools-sums-")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	downloaded, _, err := download(ctx, dir, checksumURL, versioned+"-"+platform+".sums", opts.retryPolicy())
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(downloaded)
+	if err != nil {
+		return "", err
+	}
+	want, err := parseChecksums(data, fileName(source))
+	if err != nil {
+		return "", fmt.Errorf("%s: %s: %w", versioned, checksumURL, err)
+	}
+	return want, nil
+}
+
+// parseChecksums returns the digest of file as listed in data, the output of sha256sum, sha384sum
+// or sha512sum, e.g. "<hex>  file" or "<hex> *file", in the BSD format, e.g.
+// "SHA512 (file) = <hex>", or a single "<hex>" as published next to an artifact.
+func parseChecksums(data []byte, file string) (string, error) {
+	var single []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var algorithm, encoded, listed string
+		if prefix, rest, ok := strings.Cut(line, " ("); ok && strings.Contains(rest, ") = ") {
+			algorithm = strings.ToLower(prefix)
+			listed, encoded, _ = strings.Cut(rest, ") = ")
+		} else {
+			fields := strings.Fields(line)
+			encoded = fields[0]
+			algorithm = hexAlgorithms[len(encoded)]
+			if len(fields) > 1 {
+				listed = strings.TrimPrefix(fields[len(fields)-1], "*")
+			}
+		}
+		d, err := parseDigest(algorithm + ":" + strings.ToLower(encoded))
+		if err != nil {
+			continue
+		}
+		if listed == "" {
+			single = append(single, d.String())
+			continue
+		}
+		if listed == file || path.Base(listed) == file {
+			return d.String(), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if len(single) == 1 {
+		return single[0], nil
+	}
+	return "", fmt.Errorf("no digest for %s: %w", file, ErrEntryInvalid)
+}
+
+// hexAlgorithms are the digest algorithms by the length of their hex digests.
+var hexAlgorithms = map[int]string{
+	sha256.Size * 2:    "sha256",
+	sha512.Size384 * 2: "sha384",
+	sha512.Size * 2:    "sha512",
+}
+
+// fileName returns the name of the file at rawURL.
+func fileName(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return path.Base(u.Path)
+	}
+	return path.Base(rawURL)
+}
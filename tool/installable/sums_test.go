@@ -0,0 +1,82 @@
+package installable
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChecksums(t *testing.T) {
+	const (
+		arm = "79ef06935fb47e432c0c91bdefd140e5b543ec46376007ca14a52e5ed3023088"
+		amd = "1033f26361e6fc30ffcfab9d4e4274ffd4af88d9c97de63d2e1721c4a07c1380"
+	)
+	sha512 := strings.Repeat(arm, 2)
+	tests := []struct {
+		name string
+		data string
+		file string
+		want string
+	}{
+		{"text mode", amd + "  buf-Linux-x86_64.tar.gz\n" + arm + "  buf-Linux-aarch64.tar.gz\n", "buf-Linux-aarch64.tar.gz", "sha256:" + arm},
+		{"binary mode", arm + " *dist/buf-Linux-aarch64.tar.gz\n", "buf-Linux-aarch64.tar.gz", "sha256:" + arm},
+		{"bsd", "SHA256 (buf-Linux-aarch64.tar.gz) = " + arm + "\n", "buf-Linux-aarch64.tar.gz", "sha256:" + arm},
+		{"single", arm + "\n", "buf-Linux-aarch64.tar.gz", "sha256:" + arm},
+		{"sha512", sha512 + "  buf-Linux-aarch64.tar.gz\n", "buf-Linux-aarch64.tar.gz", "sha512:" + sha512},
+		{"bsd sha512", "SHA512 (buf-Linux-aarch64.tar.gz) = " + sha512 + "\n", "buf-Linux-aarch64.tar.gz", "sha512:" + sha512},
+		{"missing", amd + "  buf-Linux-x86_64.tar.gz\n", "buf-Linux-aarch64.tar.gz", ""},
+	}
+	for _, test := range tests {
+		got, err := parseChecksums([]byte(test.data), test.file)
+		if test.want == "" {
+			require.ErrorIs(t, err, ErrEntryInvalid, test.name)
+			continue
+		}
+		require.NoError(t, err, test.name)
+		require.Equal(t, test.want, got, test.name)
+	}
+}
+
+func TestChecksumURL(t *testing.T) {
+	content := []byte("#!/bin/sh\necho kind\n")
+	sum := sha256.Sum256(content)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path.Base(r.URL.Path) {
+		case "checksums.txt":
+			_, _ = w.Write([]byte(hex.EncodeToString(sum[:]) + "  kind-" + hostPlatform + "\n"))
+		default:
+			_, _ = w.Write(content)
+		}
+	}))
+	defer srv.Close()
+
+	bin := &httpBinary{
+		name:      "kind",
+		version:   "v0.20.0",
+		versioned: "kind@v0.20.0",
+		source:    srv.URL + "/{{ .Version }}/kind-{{ .OS }}-{{ .Arch }}",
+		option:    httpBinaryOption{ChecksumURL: srv.URL + "/{{ .Version }}/checksums.txt"},
+	}
+	lock, err := LoadLock(nil)
+	require.NoError(t, err)
+	installed, err := bin.Install(context.Background(), t.TempDir(), Options{Lock: lock})
+	require.NoError(t, err)
+	data, err := os.ReadFile(path.Join(installed, "kind"))
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+	require.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), lock.Tools["kind"].Artifacts[hostPlatform].Digest)
+
+	// Later installs are pinned by the lock, even when the artifact changes upstream.
+	content = []byte("#!/bin/sh\necho tampered\n")
+	sum = sha256.Sum256(content)
+	_, err = bin.Install(context.Background(), t.TempDir(), Options{Lock: lock})
+	require.ErrorIs(t, err, ErrEntryInvalid)
+}
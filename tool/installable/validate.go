@@ -0,0 +1,175 @@
+package installable
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Validate reports every problem of data, a .magetools.yaml file, each as a *ConfigError, without
+// installing anything, e.g. in a pre-commit hook.
+func Validate(data []byte) error {
+	_, err := Load(data)
+	return err
+}
+
+// validate reports the problems of the entry itself: missing and unknown fields, and an invalid
+// condition.
+func (e Entry) validate() []error {
+	var errs []error
+	for _, required := range []struct{ field, value string }{
+		{"name", e.Name},
+		{"type", e.Type},
+		{"version", e.Version},
+		{"source", e.Source},
+	} {
+		if required.value == "" {
+			errs = append(errs, &ConfigError{Field: required.field, Err: errors.New("is required")})
+		}
+	}
+	if _, err := e.condition(); err != nil {
+		errs = append(errs, &ConfigError{Field: "when", Err: err})
+	}
+	if e.node != nil {
+		errs = append(errs, checkFields(e.node, reflect.TypeOf(e), "")...)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return e.configErrors(errors.Join(errs...))
+}
+
+// checkDuplicates reports the entries declaring the same version of a name as a previous one, or
+// another type or source. Versions of a name are only installed side by side when they are of the
+// same tool.
+func (e *entries) checkDuplicates() []error {
+	var errs []error
+	seen := make(map[string]Entry, len(e.Data))
+	first := make(map[string]Entry, len(e.Data))
+	for _, entry := range e.Data {
+		if previous, ok := first[entry.Name]; !ok {
+			first[entry.Name] = entry
+		} else if field, value := previous.differs(entry); field != "" {
+			err := fmt.Errorf("%s: %s differs from %s of another version", field, value, previous.Versioned())
+			if previous.node != nil {
+				err = fmt.Errorf("%s: %s differs from %s at line %d", field, value, previous.Versioned(), previous.node.Line)
+			}
+			errs = append(errs, entry.configErrors(err)...)
+			continue
+		}
+		previous, ok := seen[entry.Versioned()]
+		if !ok {
+			seen[entry.Versioned()] = entry
+			continue
+		}
+		err := fmt.Errorf("duplicate of %s", entry.Versioned())
+		if previous.node != nil {
+			err = fmt.Errorf("duplicate of %s at line %d", entry.Versioned(), previous.node.Line)
+		}
+		errs = append(errs, entry.configErrors(err)...)
+	}
+	return errs
+}
+
+// differs returns the field, type or source, and its value in other when other is not another
+// version of the same tool as e.
+func (e Entry) differs(other Entry) (string, string) {
+	switch {
+	case other.Type != e.Type:
+		return "type", other.Type
+	case other.Source != e.Source:
+		return "source", other.Source
+	}
+	return "", ""
+}
+
+func (e *entries) names() []string {
+	names := make([]string, 0, len(e.Data))
+	for _, entry := range e.Data {
+		names = append(names, entry.Name)
+	}
+	return names
+}
+
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// checkFields reports the keys of node unknown to t, the type it decodes to, as a strict decoder
+// would, but located. field is the path of node, e.g. option.
+func checkFields(node *yaml.Node, t reflect.Type, field string) []error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	var errs []error
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		known := yamlFields(t)
+		keys := make([]string, 0, len(known))
+		for key := range known {
+			keys = append(keys, key)
+		}
+		for idx := 0; idx+1 < len(node.Content); idx += 2 {
+			key, value := node.Content[idx], node.Content[idx+1]
+			path := strings.TrimPrefix(field+"."+key.Value, ".")
+			fieldType, ok := known[key.Value]
+			if !ok {
+				errs = append(errs, &ConfigError{
+					Field:      path,
+					Line:       key.Line,
+					Column:     key.Column,
+					Err:        errors.New("unknown field"),
+					Suggestion: suggest(key.Value, keys),
+				})
+				continue
+			}
+			if reflect.PointerTo(fieldType).Implements(unmarshalerType) {
+				// Checked when decoded, e.g. entries.
+				continue
+			}
+			errs = append(errs, checkFields(value, fieldType, path)...)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for idx := 0; idx+1 < len(node.Content); idx += 2 {
+			errs = append(errs, checkFields(node.Content[idx+1], t.Elem(), field+"."+node.Content[idx].Value)...)
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		if reflect.PointerTo(t.Elem()).Implements(unmarshalerType) {
+			return nil
+		}
+		for _, item := range node.Content {
+			errs = append(errs, checkFields(item, t.Elem(), field)...)
+		}
+	}
+	return errs
+}
+
+// yamlFields returns the types of the fields of the struct t by their yaml keys.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for idx := 0; idx < t.NumField(); idx++ {
+		f := t.Field(idx)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if opts == "inline" && f.Type.Kind() == reflect.Struct {
+			for key, fieldType := range yamlFields(f.Type) {
+				fields[key] = fieldType
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
@@ -0,0 +1,89 @@
+package installable
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, Validate([]byte(`tools:
+  - name: buf
+    type: go:binary
+    version: v1.26.1
+    source: github.com/bufbuild/buf/cmd/buf
+  - name: buf
+    type: go:binary
+    version: v1.29.0
+    source: github.com/bufbuild/buf/cmd/buf
+`)))
+
+	// Another tool of the same name, rather than another version.
+	err := Validate([]byte(`tools:
+  - name: buf
+    type: go:binary
+    version: v1.26.1
+    source: github.com/bufbuild/buf/cmd/buf
+  - name: buf
+    type: http:archive
+    version: v1.29.0
+    source: https://github.com/bufbuild/buf/releases/download/{{ .Version }}/buf-{{ .OSArch }}{{ .Ext }}
+  - name: helm
+    type: http:archive
+    version: v3.12.3
+    source: https://get.helm.sh/helm-{{ .Version }}-{{ .OS }}-{{ .Arch }}{{ .Ext }}
+  - name: helm
+    type: http:archive
+    version: v3.13.0
+    source: https://example.com/helm-{{ .Version }}-{{ .OS }}-{{ .Arch }}{{ .Ext }}
+`))
+	require.ErrorIs(t, err, ErrEntryInvalid)
+	require.Equal(t, `line 6, column 5: buf: type: http:archive differs from buf@v1.26.1 at line 2
+line 14, column 5: helm: source: https://example.com/helm-{{ .Version }}-{{ .OS }}-{{ .Arch }}{{ .Ext }} differs from helm@v3.12.3 at line 10`, err.Error())
+
+	err = Validate([]byte(`tool:
+  - name: buf
+tools:
+  - name: buf
+    type: go:binary
+    version: v1.26.1
+    source: github.com/bufbuild/buf/cmd/buf
+  - name: buf
+    type: go:binary
+    version: v1.26.1
+    source: github.com/bufbuild/buf/cmd/buf
+  - name: helm
+    type: http:archive
+    verison: v3.12.3
+    source: https://get.helm.sh/helm-{{ .Version }}-{{ .OS }}-{{ .Arch }}{{ .Ext }}
+  - name: ko
+    type: http:archive
+    version: v0.14.1
+    source: https://github.com/ko-build/ko/releases/download/{{ .Version }}/ko_{{ trimV .Version }}_{{ .OS }}_{{ .Arch }}{{ .Ext }}
+    option:
+      stripPrefix: ko_{{ .Version }
+  - name: kind
+    type: http:binary
+    version: v0.20.0
+    source: https://kind.sigs.k8s.io/dl/{{ .Version }}/kind-{{ .OS }}-{{ .Arch }}
+    option:
+      checksumUrl: https://kind.sigs.k8s.io/dl/{{ .Version }}/kind-{{ .OS }}-{{ .Arch }}.sha256sum
+      overrides:
+        os:
+          darwin: macos
+  - name: prettier
+    type: npm:binary
+    version: v3.0.3
+    source: prettier
+    option:
+      runtime: nodejs
+`))
+	require.ErrorIs(t, err, ErrEntryInvalid)
+	require.Equal(t, `line 1, column 1: tool: unknown field, did you mean "tools"?
+line 8, column 5: buf: duplicate of buf@v1.26.1 at line 4
+line 12, column 5: helm: version: is required
+line 14, column 5: helm: verison: unknown field, did you mean "version"?
+line 21, column 20: ko: option.stripPrefix: template: option.stripPrefix:1: unexpected "}" in operand
+line 27, column 7: kind: option.checksumUrl: unknown field, did you mean "checksumURL"?
+line 36, column 16: prettier: option.runtime: unknown runtime "nodejs"`, err.Error())
+}
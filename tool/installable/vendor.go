@@ -0,0 +1,92 @@
+package installable
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Vendorable is implemented by installables able to put their artifacts for any platform in a
+// cache, e.g. to bundle them for air-gapped environments.
+type Vendorable interface {
+	// Vendor puts the artifacts of the installable for platform, e.g. linux-arm64, in opts.Cache,
+	// records them in opts.Lock, and returns their paths relative to the cache directory.
+	Vendor(ctx context.Context, platform string, opts Options) ([]string, error)
+}
+
+// vendorDownload puts the artifact downloaded from url for platform, verified against want and with
+// verify, in opts.Cache.
+func vendorDownload(ctx context.Context, name, versioned, platform, url, want string, tool LockedTool, verify func(file string) error, opts Options) ([]string, error) {
+	blob, release, ok := "", func() {}, false
+	if want != "" {
+		blob, release, ok = opts.Cache.get(want)
+	}
+	if !ok {
+		if opts.Offline {
+			return nil, &MissingArtifactError{Tool: versioned, Platform: platform, Source: url}
+		}
+		// Without the tool lock, so in a directory of its own, next to the cache so the download is
+		// moved into it rather than copied.
+		if err := os.MkdirAll(opts.Cache.Dir(), os.ModePerm); err != nil {
+			return nil, err
+		}
+		dir, err := os.MkdirTemp(opts.Cache.Dir(), ".vendor-")
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = os.RemoveAll(dir)
+		}()
+		downloaded, digest, err := download(ctx, dir, url, versioned+"-"+platform, opts.retryPolicy())
+		if err != nil {
+			return nil, err
+		}
+		if err = checksum(versioned, want, downloaded, digest); err != nil {
+			return nil, err
+		}
+		if err = opts.Cache.put(digest, downloaded, want); err != nil {
+			return nil, err
+		}
+		if blob, release, ok = opts.Cache.get(digest); !ok {
+			return nil, fmt.Errorf("failed to cache %s for %s", versioned, platform)
+		}
+	}
+	defer release()
+	if err := verify(blob); err != nil {
+		return nil, err
+	}
+	if err := opts.Lock.RecordFor(name, platform, tool, LockedArtifact{URL: url, Digest: blobDigest(blob)}); err != nil {
+		return nil, err
+	}
+	// Its signatures, if any, to verify it offline.
+	files := append([]string{blob}, opts.Cache.signatures(blob)...)
+	if d, err := parseDigest(want); err == nil && d.algorithm != "sha256" {
+		// The alias to find the artifact by want.
+		files = append(files, opts.Cache.blobPath(d))
+	}
+	for idx, file := range files {
+		rel, err := filepath.Rel(opts.Cache.Dir(), file)
+		if err != nil {
+			return nil, err
+		}
+		files[idx] = rel
+	}
+	return files, nil
+}
+
+// vendorTree puts the tree of key for platform, built with build when missing, in opts.Cache.
+func vendorTree(key, versioned, platform, source string, build func(dir string) error, opts Options) (string, string, error) {
+	tree, release, err := opts.Cache.tree(key, func(dir string) error {
+		if opts.Offline {
+			return &MissingArtifactError{Tool: versioned, Platform: platform, Source: source}
+		}
+		return build(dir)
+	})
+	if err != nil {
+		return "", "", err
+	}
+	release()
+	rel, err := filepath.Rel(opts.Cache.Dir(), tree)
+	return tree, rel, err
+}
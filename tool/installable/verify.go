@@ -0,0 +1,87 @@
+package installable
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// VerifyPolicy controls how artifacts without a digest to verify them against are installed, e.g.
+// on a platform missing from shas.
+type VerifyPolicy string
+
+const (
+	// VerifyRequired fails to install artifacts without a digest. It is the default.
+	VerifyRequired VerifyPolicy = "required"
+	// VerifyWarn installs artifacts without a digest, with a warning.
+	VerifyWarn VerifyPolicy = "warn"
+	// VerifyTOFU trusts artifacts without a digest on first use, recording their digest in
+	// Options.TrustDir, and fails when it changes afterward.
+	VerifyTOFU VerifyPolicy = "tofu"
+)
+
+func (p VerifyPolicy) validate() error {
+	switch p {
+	case "", VerifyRequired, VerifyWarn, VerifyTOFU:
+		return nil
+	}
+	return fmt.Errorf("unknown verify policy %q, expecting required, warn or tofu", p)
+}
+
+// or returns p, or fallback when p is not set.
+func (p VerifyPolicy) or(fallback VerifyPolicy) VerifyPolicy {
+	if p == "" {
+		return fallback
+	}
+	return p
+}
+
+// unverified returns the digest the artifact of versioned for platform must have when it has
+// none, following policy: either the one trusted on first use, or an empty one for an artifact
+// installed as is.
+func unverified(versioned, platform string, policy VerifyPolicy, opts Options) (string, error) {
+	switch policy {
+	case VerifyWarn:
+		output.Printf("WARNING: %s for %s is not verified, it has no sha", versioned, platform)
+		return "", nil
+	case VerifyTOFU:
+		if opts.TrustDir == "" {
+			return "", fmt.Errorf("%s: verify tofu requires a trust directory: %w", versioned, ErrEntryInvalid)
+		}
+		data, err := os.ReadFile(trustFile(opts.TrustDir, versioned, platform))
+		if err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		output.Printf("WARNING: %s for %s has no sha, trusting it on first use", versioned, platform)
+		return "", nil
+	}
+	return "", fmt.Errorf("%s has no sha for %s, add one or set verify to warn or tofu: %w", versioned, platform, ErrEntryInvalid)
+}
+
+// trust records the digest of file, the artifact of versioned for platform, when it is trusted on
+// first use, i.e. it has no digest to be verified against.
+func trust(versioned, platform, want, file string, policy VerifyPolicy, opts Options) error {
+	if policy != VerifyTOFU || want != "" {
+		return nil
+	}
+	d, err := digestFile("sha256", file)
+	if err != nil {
+		return err
+	}
+	trusted := trustFile(opts.TrustDir, versioned, platform)
+	if err = os.MkdirAll(filepath.Dir(trusted), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(trusted, []byte(d.String()+"\n"), 0o644)
+}
+
+// trustFile returns the file recording the digest of the artifact of versioned for platform,
+// trusted on first use.
+func trustFile(dir, versioned, platform string) string {
+	return filepath.Join(dir, versioned, platform)
+}
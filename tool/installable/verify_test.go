@@ -0,0 +1,66 @@
+package installable
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyPolicy(t *testing.T) {
+	content := []byte("#!/bin/sh\necho kind\n")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	newBin := func(verify VerifyPolicy) *httpBinary {
+		return &httpBinary{
+			name:      "kind",
+			version:   "v0.20.0",
+			versioned: "kind@v0.20.0",
+			source:    srv.URL + "/{{ .Version }}/kind",
+			option:    httpBinaryOption{SHAs: map[string]string{"plan9-mips": "sha256:stale"}, Verify: verify},
+		}
+	}
+
+	{
+		_, err := newBin("").Install(context.Background(), t.TempDir(), Options{})
+		require.ErrorIs(t, err, ErrEntryInvalid)
+		require.ErrorContains(t, err, "kind@v0.20.0 has no sha for "+hostPlatform)
+	}
+
+	{
+		// The entry overrides the policy of the file.
+		installed, err := newBin(VerifyWarn).Install(context.Background(), t.TempDir(), Options{Verify: VerifyRequired})
+		require.NoError(t, err)
+		data, err := os.ReadFile(path.Join(installed, "kind"))
+		require.NoError(t, err)
+		require.Equal(t, content, data)
+	}
+
+	{
+		trustDir := t.TempDir()
+		opts := Options{Verify: VerifyTOFU, TrustDir: trustDir}
+		_, err := newBin("").Install(context.Background(), t.TempDir(), opts)
+		require.NoError(t, err)
+		trusted, err := os.ReadFile(trustFile(trustDir, "kind@v0.20.0", hostPlatform))
+		require.NoError(t, err)
+		require.Contains(t, string(trusted), "sha256:")
+
+		_, err = newBin("").Install(context.Background(), t.TempDir(), opts)
+		require.NoError(t, err)
+
+		// Once trusted, a changed artifact fails.
+		content = []byte("#!/bin/sh\necho tampered\n")
+		_, err = newBin("").Install(context.Background(), t.TempDir(), opts)
+		require.ErrorIs(t, err, ErrEntryInvalid)
+	}
+
+	_, err := Load([]byte("verify: maybe\ntools: []\n"))
+	require.ErrorContains(t, err, `unknown verify policy "maybe"`)
+}
@@ -0,0 +1,323 @@
+package installable
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Facts are what the when: condition of an entry is evaluated against.
+type Facts struct {
+	// OS and Arch are the platform, e.g. linux and amd64.
+	OS, Arch string
+	// CI is set when running on CI.
+	CI bool
+	// Env looks up an environment variable.
+	Env func(string) (string, bool)
+	// LookPath reports whether a command is on PATH.
+	LookPath func(string) bool
+	// Groups are the groups being installed, if any.
+	Groups []string
+}
+
+// HostFacts returns the facts of the running process, installing groups.
+func HostFacts(groups ...string) Facts {
+	return Facts{
+		OS:     runtime.GOOS,
+		Arch:   runtime.GOARCH,
+		CI:     onCI(),
+		Env:    os.LookupEnv,
+		Groups: groups,
+		LookPath: func(command string) bool {
+			_, err := exec.LookPath(command)
+			return err == nil
+		},
+	}
+}
+
+// onCI reports whether CI is set, e.g. to true, and not to false.
+func onCI() bool {
+	ci := os.Getenv("CI")
+	off, err := strconv.ParseBool(ci)
+	return ci != "" && (err != nil || off)
+}
+
+// Condition is the when: condition of an entry, installed only when it is met. It combines with
+// &&, || and ! and parentheses:
+//
+//   - os and arch, compared with == or != to a string, e.g. os == "linux".
+//   - env.NAME, set when used alone, or compared to its value, e.g. env.GOFLAGS != "".
+//   - ci, when running on CI.
+//   - path("node"), when node is on PATH.
+//   - group("frontend"), when the frontend group is being installed.
+//
+// For example, to use the node already on PATH on CI: !(ci && path("node")).
+type Condition struct {
+	expr string
+	eval func(Facts) bool
+}
+
+// ParseCondition parses expr, a when: condition.
+func ParseCondition(expr string) (*Condition, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &conditionParser{tokens: tokens}
+	eval, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s", p.tokens[p.pos])
+	}
+	return &Condition{expr: expr, eval: eval}, nil
+}
+
+// Met reports whether the condition is met by facts.
+func (c *Condition) Met(facts Facts) bool {
+	return c.eval(facts)
+}
+
+// String returns the expression of the condition.
+func (c *Condition) String() string {
+	return c.expr
+}
+
+// conditionOperators are the operators of conditions, longest first.
+var conditionOperators = []string{"&&", "||", "==", "!=", "!", "(", ")"}
+
+// tokenize splits expr into identifiers, e.g. env.CI, quoted strings and operators.
+func tokenize(expr string) ([]string, error) {
+	var tokens []string
+	for rest := strings.TrimSpace(expr); rest != ""; rest = strings.TrimLeftFunc(rest, unicode.IsSpace) {
+		switch {
+		case rest[0] == '"' || rest[0] == '\'':
+			end := strings.IndexByte(rest[1:], rest[0])
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string %s", rest)
+			}
+			tokens, rest = append(tokens, rest[:end+2]), rest[end+2:]
+			continue
+		case isIdentifier(rune(rest[0])):
+			end := strings.IndexFunc(rest, func(r rune) bool { return !isIdentifier(r) })
+			if end < 0 {
+				end = len(rest)
+			}
+			tokens, rest = append(tokens, rest[:end]), rest[end:]
+			continue
+		}
+		idx := slices.IndexFunc(conditionOperators, func(operator string) bool { return strings.HasPrefix(rest, operator) })
+		if idx < 0 {
+			return nil, fmt.Errorf("unexpected %q", rest[0])
+		}
+		tokens, rest = append(tokens, conditionOperators[idx]), rest[len(conditionOperators[idx]):]
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("is empty")
+	}
+	return tokens, nil
+}
+
+func isIdentifier(r rune) bool {
+	return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// conditionParser parses tokens by recursive descent, from the lowest precedence: ||, then &&,
+// then !.
+type conditionParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *conditionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *conditionParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *conditionParser) expect(token string) error {
+	if got := p.next(); got != token {
+		if got == "" {
+			return fmt.Errorf("expecting %s at the end", token)
+		}
+		return fmt.Errorf("expecting %s, got %s", token, got)
+	}
+	return nil
+}
+
+func (p *conditionParser) or() (func(Facts) bool, error) {
+	left, err := p.and()
+	for err == nil && p.peek() == "||" {
+		p.next()
+		var right func(Facts) bool
+		if right, err = p.and(); err == nil {
+			l := left
+			left = func(f Facts) bool { return l(f) || right(f) }
+		}
+	}
+	return left, err
+}
+
+func (p *conditionParser) and() (func(Facts) bool, error) {
+	left, err := p.not()
+	for err == nil && p.peek() == "&&" {
+		p.next()
+		var right func(Facts) bool
+		if right, err = p.not(); err == nil {
+			l := left
+			left = func(f Facts) bool { return l(f) && right(f) }
+		}
+	}
+	return left, err
+}
+
+func (p *conditionParser) not() (func(Facts) bool, error) {
+	switch p.peek() {
+	case "!":
+		p.next()
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(f Facts) bool { return !operand(f) }, nil
+	case "(":
+		p.next()
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	}
+	return p.term()
+}
+
+// conditionFunctions are the functions of conditions, called with a string.
+var conditionFunctions = map[string]func(Facts, string) bool{
+	"path": func(f Facts, command string) bool {
+		return f.LookPath != nil && f.LookPath(command)
+	},
+	"group": func(f Facts, group string) bool {
+		return slices.Contains(f.Groups, group)
+	},
+}
+
+// term parses a comparison, a call, ci, or env.NAME alone.
+func (p *conditionParser) term() (func(Facts) bool, error) {
+	token := p.next()
+	if fn, ok := conditionFunctions[token]; ok {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		arg, err := unquote(p.next())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", token, err)
+		}
+		return func(f Facts) bool { return fn(f, arg) }, p.expect(")")
+	}
+	if token == "ci" {
+		return func(f Facts) bool { return f.CI }, nil
+	}
+	left, err := p.value(token)
+	if err != nil {
+		return nil, err
+	}
+	operator := p.peek()
+	if operator != "==" && operator != "!=" {
+		if name, ok := strings.CutPrefix(token, "env."); ok {
+			return func(f Facts) bool {
+				if f.Env == nil {
+					return false
+				}
+				_, ok := f.Env(name)
+				return ok
+			}, nil
+		}
+		return nil, fmt.Errorf("%s is not a condition, compare it, e.g. %s == %q", token, token, "value")
+	}
+	p.next()
+	right, err := p.value(p.next())
+	if err != nil {
+		return nil, err
+	}
+	if operator == "==" {
+		return func(f Facts) bool { return left(f) == right(f) }, nil
+	}
+	return func(f Facts) bool { return left(f) != right(f) }, nil
+}
+
+// value parses a string operand: os, arch, env.NAME or a quoted string.
+func (p *conditionParser) value(token string) (func(Facts) string, error) {
+	switch token {
+	case "os":
+		return func(f Facts) string { return f.OS }, nil
+	case "arch":
+		return func(f Facts) string { return f.Arch }, nil
+	case "":
+		return nil, errors.New("unexpected end")
+	}
+	name, ok := strings.CutPrefix(token, "env.")
+	if ok && name == "" {
+		return nil, errors.New("env. needs a variable name, e.g. env.CI")
+	}
+	if ok {
+		return func(f Facts) string {
+			if f.Env == nil {
+				return ""
+			}
+			value, _ := f.Env(name)
+			return value
+		}, nil
+	}
+	if s, err := unquote(token); err == nil {
+		return func(Facts) string { return s }, nil
+	}
+	known := []string{"os", "arch", "ci", "env."}
+	for name := range conditionFunctions {
+		known = append(known, name)
+	}
+	// Sorted, so ties suggest the same one each time.
+	sort.Strings(known)
+	if suggestion := suggest(token, known); suggestion != "" {
+		return nil, fmt.Errorf("unknown %s, %s", token, suggestion)
+	}
+	return nil, fmt.Errorf("unknown %s", token)
+}
+
+func unquote(token string) (string, error) {
+	if len(token) < 2 || (token[0] != '"' && token[0] != '\'') || token[len(token)-1] != token[0] {
+		return "", fmt.Errorf("expecting a quoted string, got %q", token)
+	}
+	return token[1 : len(token)-1], nil
+}
+
+// condition returns the when: condition of the entry, if any, including ci: skip in its option,
+// which predates it and skips the entry on CI.
+func (e Entry) condition() (*Condition, error) {
+	expr := e.When
+	if option, ok := e.Option.(map[string]interface{}); ok && option["ci"] == "skip" {
+		if expr == "" {
+			expr = "!ci"
+		} else {
+			expr = "(" + expr + ") && !ci"
+		}
+	}
+	if expr == "" {
+		return nil, nil
+	}
+	return ParseCondition(expr)
+}
@@ -0,0 +1,104 @@
+package installable
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCondition(t *testing.T) {
+	facts := Facts{
+		OS:   "linux",
+		Arch: "arm64",
+		CI:   true,
+		Env: func(name string) (string, bool) {
+			value, ok := map[string]string{"GOFLAGS": "-mod=mod", "EMPTY": ""}[name]
+			return value, ok
+		},
+		LookPath: func(command string) bool { return command == "node" },
+		Groups:   []string{"frontend"},
+	}
+	tests := []struct {
+		expr string
+		met  bool
+	}{
+		{`os == "linux"`, true},
+		{`os != 'linux'`, false},
+		{`os == "darwin" || arch == "arm64"`, true},
+		{`os == "linux" && arch == "amd64"`, false},
+		{`env.GOFLAGS == "-mod=mod"`, true},
+		{`env.EMPTY`, true},
+		{`env.EMPTY != ""`, false},
+		{`env.MISSING`, false},
+		{`!(ci && path("node"))`, false},
+		{`!ci || path("npm")`, false},
+		{`group("frontend") && !group("proto")`, true},
+		{`!!ci`, true},
+	}
+	for _, test := range tests {
+		condition, err := ParseCondition(test.expr)
+		require.NoError(t, err, test.expr)
+		require.Equal(t, test.met, condition.Met(facts), test.expr)
+		require.Equal(t, test.expr, condition.String())
+	}
+
+	for expr, want := range map[string]string{
+		``:                   "is empty",
+		`os`:                 `os is not a condition, compare it, e.g. os == "value"`,
+		`os == linux`:        "unknown linux",
+		`oss == "linux"`:     `unknown oss, did you mean "os"?`,
+		`(ci`:                "expecting ) at the end",
+		`ci ci`:              "unexpected ci",
+		`path(node)`:         `path: expecting a quoted string, got "node"`,
+		`os == "linux`:       `unterminated string "linux`,
+		`os == "linux" & ci`: `unexpected '&'`,
+		`env. == "a"`:        "env. needs a variable name, e.g. env.CI",
+		`env.`:               "env. needs a variable name, e.g. env.CI",
+		`grop("frontend")`:   `unknown grop, did you mean "group"?`,
+	} {
+		_, err := ParseCondition(expr)
+		require.EqualError(t, err, want, expr)
+	}
+
+	{
+		installables, err := LoadGraph([]byte(`tools:
+  - name: node
+    type: http:archive
+    version: v20.5.1
+    source: 'https://nodejs.org/dist/{{ .Version }}/node-{{ .Version }}-{{ .OS }}-{{ .Arch }}{{ .Ext }}'
+    when: '!(ci && path("node"))'
+  - name: buf
+    type: go:binary
+    version: v1.26.1
+    source: github.com/bufbuild/buf/cmd/buf
+    when: os == "linux"
+    option:
+      ci: skip
+  - name: kind
+    type: go:binary
+    version: v0.20.0
+    source: sigs.k8s.io/kind
+`))
+		require.NoError(t, err)
+		node, _ := installables.Get("node")
+		require.False(t, installables.Condition(node).Met(facts))
+		// ci: skip composes with when:.
+		buf, _ := installables.Get("buf")
+		require.Equal(t, `(os == "linux") && !ci`, installables.Condition(buf).String())
+		require.False(t, installables.Condition(buf).Met(facts))
+		kind, _ := installables.Get("kind")
+		require.Nil(t, installables.Condition(kind))
+	}
+
+	{
+		_, err := Load([]byte(`tools:
+  - name: buf
+    type: go:binary
+    version: v1.26.1
+    source: github.com/bufbuild/buf/cmd/buf
+    when: os = "linux"
+`))
+		require.ErrorIs(t, err, ErrEntryInvalid)
+		require.EqualError(t, err, `line 6, column 11: buf: when: unexpected '='`)
+	}
+}
@@ -0,0 +1,54 @@
+// Package flock provides advisory file locks, shared between processes.
+package flock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLocked notifies that a lock is held by someone else.
+var ErrLocked = errors.New("locked")
+
+// pollInterval is how often a busy lock is retried.
+var pollInterval = 100 * time.Millisecond
+
+// Lock acquires an exclusive or shared lock on file, creating it when needed. It waits for the
+// lock until timeout elapses or ctx is done, and then returns ErrLocked.
+func Lock(ctx context.Context, file string, exclusive bool, timeout time.Duration) (func(), error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		unlock, err := TryLock(file, exclusive)
+		if !errors.Is(err, ErrLocked) {
+			return unlock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// TryLock acquires an exclusive or shared lock on file, creating it when needed. It returns
+// ErrLocked right away when the lock is busy.
+func TryLock(file string, exclusive bool) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err = lock(f, exclusive); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return func() {
+		_ = unlock(f)
+		_ = f.Close()
+	}, nil
+}
@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || freebsd || openbsd || netbsd || dragonfly)
+
+package flock
+
+import (
+	"os"
+)
+
+// TODO(dio): Use LockFileEx on windows. Until then, locks are not enforced there.
+func lock(*os.File, bool) error {
+	return nil
+}
+
+func unlock(*os.File) error {
+	return nil
+}
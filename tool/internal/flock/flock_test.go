@@ -0,0 +1,31 @@
+package flock
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".locks", "buf.lock")
+
+	unlockShared, err := TryLock(file, false)
+	require.NoError(t, err)
+	unlockAnotherShared, err := TryLock(file, false)
+	require.NoError(t, err)
+
+	_, err = Lock(context.Background(), file, true, 200*time.Millisecond)
+	require.ErrorIs(t, err, ErrLocked)
+
+	unlockShared()
+	unlockAnotherShared()
+	unlockExclusive, err := Lock(context.Background(), file, true, time.Second)
+	require.NoError(t, err)
+
+	_, err = TryLock(file, false)
+	require.ErrorIs(t, err, ErrLocked)
+	unlockExclusive()
+}
@@ -0,0 +1,118 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dio/magex/tool/installable"
+)
+
+// PruneOptions controls which installed versions Prune removes.
+type PruneOptions struct {
+	// DryRun reports what would be removed, without removing anything.
+	DryRun bool
+	// KeepUsedWithin keeps the versions run, or else installed, within this duration, e.g. by
+	// another branch. Zero keeps none of them.
+	KeepUsedWithin time.Duration
+}
+
+// PruneResult reports what Prune removed, or would remove in dry-run mode.
+type PruneResult struct {
+	// Removed lists the removed versions, e.g. buf@v1.26.1.
+	Removed []string
+	// Reclaimed is the size in bytes of the removed versions.
+	Reclaimed uint64
+}
+
+// Prune removes the installed versions declared neither in .magetools.yaml nor in the lock, as
+// installing a version keeps the others side by side. A version in use by another process is
+// kept.
+func (b *Box) Prune(ctx context.Context, opts PruneOptions) (PruneResult, error) {
+	var result PruneResult
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return result, err
+	}
+
+	declared := b.graph.Versions()
+	for name, locked := range b.lock.Tools {
+		if !strings.Contains(name, "@") {
+			// Versions other than the default are locked by name@version already.
+			name += "@" + locked.Version
+		}
+		declared = append(declared, name)
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		name, _, ok := strings.Cut(entry.Name(), "@")
+		if !ok || !entry.IsDir() || strings.HasPrefix(name, ".") || slices.Contains(declared, entry.Name()) {
+			continue
+		}
+		if opts.KeepUsedWithin > 0 && time.Since(b.lastUsed(entry)) < opts.KeepUsedWithin {
+			continue
+		}
+		size, err := installable.DiskUsage(filepath.Join(b.dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !opts.DryRun {
+			removed, err := b.remove(ctx, name, entry.Name())
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if !removed {
+				continue
+			}
+			_ = os.Remove(b.usedMarker(entry.Name()))
+		}
+		result.Removed = append(result.Removed, entry.Name())
+		result.Reclaimed += size
+	}
+	return result, errors.Join(errs...)
+}
+
+// remove removes versioned unless in use, while nobody installs a version of name.
+func (b *Box) remove(ctx context.Context, name, versioned string) (bool, error) {
+	unlock, err := installable.LockTool(ctx, b.dir, name, b.lockTimeout)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	return installable.RemoveUnused(b.dir, versioned)
+}
+
+// markUsed records that versioned was just run.
+func (b *Box) markUsed(versioned string) error {
+	marker := b.usedMarker(versioned)
+	now := time.Now()
+	if err := os.Chtimes(marker, now, now); err == nil || !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(marker), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(marker, nil, 0o644)
+}
+
+// lastUsed returns when an installed version was last run, or else installed.
+func (b *Box) lastUsed(entry os.DirEntry) time.Time {
+	if info, err := os.Stat(b.usedMarker(entry.Name())); err == nil {
+		return info.ModTime()
+	}
+	if info, err := entry.Info(); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+func (b *Box) usedMarker(versioned string) string {
+	return filepath.Join(b.dir, ".used", versioned)
+}
@@ -0,0 +1,54 @@
+package tool
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	b, err := LoadFromData(dir, []byte(`tools:
+  - name: buf
+    type: go:binary
+    version: v1.26.1
+    source: github.com/bufbuild/buf/cmd/buf
+  - name: buf
+    type: go:binary
+    version: v1.29.0
+    source: github.com/bufbuild/buf/cmd/buf
+`))
+	require.NoError(t, err)
+	for _, versioned := range []string{"buf@v1.0.0", "buf@v1.26.1", "buf@v1.29.0", "kind@v0.20.0", "helm@v3.12.3"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, versioned, "bin"), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, versioned, "bin", "tool"), []byte("tool"), 0o755))
+	}
+	// helm was run recently, while the others were installed a while ago.
+	long := time.Now().Add(-30 * 24 * time.Hour)
+	for _, versioned := range []string{"buf@v1.0.0", "kind@v0.20.0", "helm@v3.12.3"} {
+		require.NoError(t, os.Chtimes(filepath.Join(dir, versioned), long, long))
+	}
+	require.NoError(t, b.markUsed("helm@v3.12.3"))
+
+	{
+		result, err := b.Prune(context.Background(), PruneOptions{DryRun: true, KeepUsedWithin: 7 * 24 * time.Hour})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"buf@v1.0.0", "kind@v0.20.0"}, result.Removed)
+		require.Equal(t, uint64(8), result.Reclaimed)
+		require.DirExists(t, filepath.Join(dir, "buf@v1.0.0"))
+	}
+
+	{
+		result, err := b.Prune(context.Background(), PruneOptions{})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"buf@v1.0.0", "kind@v0.20.0", "helm@v3.12.3"}, result.Removed)
+		require.DirExists(t, filepath.Join(dir, "buf@v1.26.1"))
+		require.DirExists(t, filepath.Join(dir, "buf@v1.29.0"))
+		require.NoDirExists(t, filepath.Join(dir, "buf@v1.0.0"))
+		require.NoFileExists(t, b.usedMarker("helm@v3.12.3"))
+	}
+}
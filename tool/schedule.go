@@ -0,0 +1,185 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/dio/magex/tool/installable"
+)
+
+// task installs an installable once all of its dependencies are installed.
+type task struct {
+	name      string
+	installer installable.Installable
+	deps      []*task
+	done      chan struct{}
+
+	// lockName is set for versions other than the default of a name, which the lock pins by their
+	// name with the version, e.g. buf@v1.26.1.
+	lockName string
+	// skipped is the condition of the installable, when it is not met. Its dependencies are not
+	// scheduled for it, and the tasks depending on it run without it.
+	skipped *installable.Condition
+	// use is set to keep the installed version in use once installed, until release is called, e.g.
+	// to run it.
+	use bool
+
+	path    string
+	release func()
+	err     error
+}
+
+// schedule returns the tasks to install names with their dependencies, in installation order, as
+// their conditions are met by facts, or regardless of them when facts is nil. An installable shared
+// by several names, e.g. a runtime, has only one task.
+func (b *Box) schedule(names []string, facts *installable.Facts) ([]*task, error) {
+	var (
+		tasks []*task
+		errs  []error
+		visit func(i installable.Installable, name string) *task
+	)
+	scheduled := make(map[installable.Installable]*task)
+	// Installers come after their dependencies, which are then already scheduled.
+	visit = func(i installable.Installable, name string) *task {
+		if t, ok := scheduled[i]; ok {
+			return t
+		}
+		t := &task{
+			name:      b.graph.Name(i),
+			installer: i,
+			done:      make(chan struct{}),
+		}
+		if t.name == "" {
+			t.name = name
+		}
+		if !b.graph.IsDefault(i) {
+			t.lockName = b.graph.Versioned(i)
+		}
+		scheduled[i] = t
+		if condition := b.graph.Condition(i); facts != nil && condition != nil && !condition.Met(*facts) {
+			t.skipped = condition
+		} else {
+			for _, dep := range b.graph.Deps(i) {
+				t.deps = append(t.deps, visit(dep, ""))
+			}
+		}
+		tasks = append(tasks, t)
+		return t
+	}
+	for _, name := range names {
+		info, err := b.graph.ResolveInfo(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		visit(info.Installers[len(info.Installers)-1], info.Key)
+	}
+	return tasks, errors.Join(errs...)
+}
+
+// run runs tasks with at most concurrency installations at a time. A task whose dependency failed
+// is not run. Errors are reported per tool.
+func (b *Box) run(ctx context.Context, tasks []*task, concurrency int) error {
+	opts := installable.Options{
+		Lock:     b.lock,
+		Retry:    b.retry,
+		Cache:    b.cache,
+		Offline:  b.offline,
+		Verify:   b.graph.Verify(),
+		TrustDir: b.trustDir(),
+	}
+	sem := make(chan struct{}, max(concurrency, 1))
+
+	var wg sync.WaitGroup
+	for _, t := range tasks {
+		wg.Add(1)
+		go func(t *task) {
+			defer wg.Done()
+			defer close(t.done)
+			for _, dep := range t.deps {
+				<-dep.done
+				if dep.err != nil {
+					t.err = fmt.Errorf("%s: requires %s, which failed to install", t.name, dep.name)
+					return
+				}
+			}
+
+			if t.skipped != nil {
+				return
+			}
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// Other processes may install, upgrade or remove the same tool meanwhile.
+			unlock, err := installable.LockTool(ctx, b.dir, t.name, b.lockTimeout)
+			if err != nil {
+				t.err = err
+				return
+			}
+			defer unlock()
+
+			// Installables build in a staging directory, so a failed installation leaves nothing
+			// behind to clean up.
+			opts := opts
+			opts.LockName = t.lockName
+			p, err := t.installer.Install(ctx, b.dir, opts)
+			t.path = p
+			if err != nil {
+				t.err = fmt.Errorf("%s: %w", t.name, err)
+				return
+			}
+			if t.use {
+				// Before unlocking, so no other process removes it in between.
+				t.release, t.err = b.useInstalled(ctx, p)
+			}
+		}(t)
+	}
+	wg.Wait()
+
+	errs := make([]error, 0, len(tasks))
+	var missing []string
+	for _, t := range tasks {
+		var missingErr *installable.MissingArtifactError
+		if errors.As(t.err, &missingErr) {
+			missing = append(missing, fmt.Sprintf("  %s for %s from %s", missingErr.Tool, missingErr.Platform, missingErr.Source))
+			continue
+		}
+		errs = append(errs, t.err)
+	}
+	if len(missing) > 0 {
+		// List everything to pre-populate at once, rather than one failure at a time.
+		errs = append([]error{fmt.Errorf("%w, missing from the cache:\n%s",
+			installable.ErrOffline, strings.Join(missing, "\n"))}, errs...)
+	}
+	return errors.Join(errs...)
+}
+
+// useInstalled marks the version installed at p as in use until release is called, so other
+// processes do not remove it meanwhile, and as used for pruning.
+func (b *Box) useInstalled(ctx context.Context, p string) (func(), error) {
+	baseDir := installedBaseDir(p)
+	if baseDir == "" {
+		return func() {}, nil
+	}
+	versioned := filepath.Base(baseDir)
+	release, err := installable.UseTool(ctx, b.dir, versioned, b.lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(baseDir); err != nil {
+		release()
+		return nil, fmt.Errorf("%s: %w", versioned, err)
+	}
+	// Pruning keeps versions recently used, e.g. by another branch.
+	if err = b.markUsed(versioned); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
@@ -0,0 +1,214 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dio/magex/tool/installable"
+)
+
+type fakeInstallable struct {
+	name    string
+	runtime installable.Installable
+	err     error
+
+	mu        *sync.Mutex
+	installed *[]string
+	running   *int32
+	peak      *int32
+}
+
+func (f *fakeInstallable) Install(_ context.Context, dst string, _ installable.Options) (string, error) {
+	n := atomic.AddInt32(f.running, 1)
+	defer atomic.AddInt32(f.running, -1)
+	for {
+		peak := atomic.LoadInt32(f.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(f.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	f.mu.Lock()
+	*f.installed = append(*f.installed, f.name)
+	f.mu.Unlock()
+	return filepath.Join(dst, f.name, "bin"), f.err
+}
+
+func (f *fakeInstallable) Runtime() installable.Installable {
+	return f.runtime
+}
+
+func TestInstallConcurrently(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		installed []string
+		running   int32
+		peak      int32
+	)
+	fake := func(name string, runtime installable.Installable, err error) *fakeInstallable {
+		return &fakeInstallable{name: name, runtime: runtime, err: err, mu: &mu, installed: &installed, running: &running, peak: &peak}
+	}
+	node := fake("node", nil, nil)
+	broken := fake("broken", nil, errors.New("boom"))
+	graph := installable.NewGraph(installable.Installables{
+		"node":     node,
+		"prettier": fake("prettier", node, nil),
+		"serve":    fake("serve", node, nil),
+		"broken":   broken,
+		"needy":    fake("needy", broken, nil),
+		"kind":     fake("kind", nil, nil),
+		"helm":     fake("helm", nil, nil),
+	})
+
+	dir := t.TempDir()
+	b := &Box{dir: dir, graph: graph, concurrency: 2}
+	p, _, err := b.install(context.Background(), nil, false, "prettier", "serve", "kind", "helm", "needy")
+	require.ErrorContains(t, err, "broken: boom")
+	require.ErrorContains(t, err, "needy: requires broken, which failed to install")
+
+	require.LessOrEqual(t, peak, int32(2))
+	require.NotContains(t, installed, "needy")
+	require.ElementsMatch(t, []string{"node", "prettier", "serve", "kind", "helm", "broken"}, installed)
+	for _, name := range []string{"prettier", "serve"} {
+		require.Less(t, slices.Index(installed, "node"), slices.Index(installed, name))
+	}
+	// Paths keep the order of names, with runtimes first.
+	require.True(t, strings.HasPrefix(p, filepath.Join(dir, "node", "bin")+":"+filepath.Join(dir, "prettier", "bin")+":"))
+}
+
+func TestFrozenVersions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	config := filepath.Join(dir, ".magetools.yaml")
+	require.NoError(t, os.WriteFile(config, []byte(`verify: warn
+tools:
+  - name: ok
+    type: http:binary
+    version: v1.0.0
+    source: '`+srv.URL+`/{{ .Version }}'
+  - name: ok
+    type: http:binary
+    version: v2.0.0
+    source: '`+srv.URL+`/{{ .Version }}'
+`), 0o644))
+
+	// A version other than the default is pinned too, by name@version.
+	b, err := LoadFromFile(filepath.Join(dir, "frozen"), config)
+	require.NoError(t, err)
+	b.SetFrozen(true)
+	_, err = b.Install(context.Background(), "ok@v1.0.0")
+	require.ErrorIs(t, err, installable.ErrLockMismatch)
+	require.ErrorContains(t, err, "ok@v1.0.0 is not locked")
+	require.NoDirExists(t, filepath.Join(dir, "frozen", "ok@v1.0.0"))
+
+	b, err = LoadFromFile(filepath.Join(dir, "magetools"), config)
+	require.NoError(t, err)
+	_, err = b.Install(context.Background(), "ok", "ok@v1.0.0")
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(dir, ".magetools.lock"))
+	require.NoError(t, err)
+	require.Contains(t, string(data), "  ok:\n    version: v2.0.0\n")
+	require.Contains(t, string(data), "  ok@v1.0.0:\n    version: v1.0.0\n")
+
+	b, err = LoadFromFile(filepath.Join(dir, "frozen"), config)
+	require.NoError(t, err)
+	b.SetFrozen(true)
+	_, err = b.Install(context.Background(), "ok@v1.0.0")
+	require.NoError(t, err)
+}
+
+func TestInstallInUse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	config := filepath.Join(dir, ".magetools.yaml")
+	require.NoError(t, os.WriteFile(config, []byte(`verify: warn
+tools:
+  - name: ok
+    type: http:binary
+    version: v1.0.0
+    source: '`+srv.URL+`/{{ .Version }}'
+`), 0o644))
+	b, err := LoadFromFile(filepath.Join(dir, "magetools"), config)
+	require.NoError(t, err)
+
+	// In use as soon as installed, before the tool is unlocked, so it is not pruned meanwhile.
+	_, release, err := b.install(context.Background(), nil, true, "ok")
+	require.NoError(t, err)
+	removed, err := b.remove(context.Background(), "ok", "ok@v1.0.0")
+	require.NoError(t, err)
+	require.False(t, removed)
+	release()
+	removed, err = b.remove(context.Background(), "ok", "ok@v1.0.0")
+	require.NoError(t, err)
+	require.True(t, removed)
+}
+
+func TestPlan(t *testing.T) {
+	t.Setenv("CI", "true")
+	b, err := LoadFromData(t.TempDir(), []byte(`tools:
+  - name: node
+    type: http:archive
+    version: v20.5.1
+    source: 'https://nodejs.org/dist/{{ .Version }}/node-{{ .Version }}-{{ .OS }}-{{ .Arch }}{{ .Ext }}'
+    when: '!ci || group("frontend")'
+  - name: prettier
+    type: npm:binary
+    version: v3.0.3
+    source: prettier
+    groups: [frontend]
+    option:
+      runtime: node
+  - name: lint
+    type: go:binary
+    version: v0.1.0
+    source: example.com/lint
+    deps: [prettier]
+    when: path("magetools-missing")
+  - name: buf
+    type: go:binary
+    version: v1.26.1
+    source: github.com/bufbuild/buf/cmd/buf
+    groups: [frontend]
+    option:
+      ci: skip
+`))
+	require.NoError(t, err)
+
+	// The dependencies of a skipped tool are not planned for it.
+	planned, err := b.Plan("lint", "prettier")
+	require.NoError(t, err)
+	require.Equal(t, []PlannedTool{
+		{Name: "lint", Skipped: `path("magetools-missing")`},
+		{Name: "node", Skipped: `!ci || group("frontend")`},
+		{Name: "prettier"},
+	}, planned)
+
+	planned, err = b.PlanGroup("frontend")
+	require.NoError(t, err)
+	require.Equal(t, []PlannedTool{{Name: "node"}, {Name: "prettier"}, {Name: "buf", Skipped: "!ci"}}, planned)
+
+	// CI=false is not CI.
+	t.Setenv("CI", "false")
+	planned, err = b.Plan("buf")
+	require.NoError(t, err)
+	require.Equal(t, []PlannedTool{{Name: "buf"}}, planned)
+}